@@ -0,0 +1,138 @@
+package blend
+
+import (
+	"math"
+	"strconv"
+)
+
+// Camelot is a position on the Camelot wheel DJs use for harmonic mixing:
+// Number runs 1-12 around the circle of fifths, Minor picks the inner (A)
+// ring over the outer (B) one.
+type Camelot struct {
+	Number int
+	Minor  bool
+}
+
+func (c Camelot) String() string {
+	if c.Minor {
+		return strconv.Itoa(c.Number) + "A"
+	}
+	return strconv.Itoa(c.Number) + "B"
+}
+
+// CamelotKey maps a Spotify pitch class and mode onto the wheel. ok is false
+// when the key is unknown.
+func CamelotKey(key, mode int) (c Camelot, ok bool) {
+	if key < 0 || key > 11 {
+		return Camelot{}, false
+	}
+	minor := mode == 0
+	if minor {
+		// A minor key sits on the same number as its relative major
+		key = (key + 3) % 12
+	}
+	// Each step round the wheel is a fifth (7 semitones); C major is 8B
+	return Camelot{Number: (key*7+7)%12 + 1, Minor: minor}, true
+}
+
+// Harmonic relations between two keys, from smoothest to roughest.
+const (
+	SameKey     = "same"
+	RelativeKey = "relative"
+	AdjacentKey = "adjacent"
+	KeyClash    = "clash"
+)
+
+// KeyRelation says how two keys mix: the same key, its relative major or
+// minor, one step round the wheel, or a clash. Unknown keys always clash.
+func KeyRelation(a, b Features) string {
+	ca, okA := CamelotKey(a.Key, a.Mode)
+	cb, okB := CamelotKey(b.Key, b.Mode)
+	if !okA || !okB {
+		return KeyClash
+	}
+	step := (ca.Number - cb.Number + 12) % 12
+	switch {
+	case step == 0 && ca.Minor == cb.Minor:
+		return SameKey
+	case step == 0:
+		return RelativeKey
+	case (step == 1 || step == 11) && ca.Minor == cb.Minor:
+		return AdjacentKey
+	}
+	return KeyClash
+}
+
+// TempoGap is the BPM difference between two tracks, allowing for mixing
+// one at double or half the tempo of the other.
+func TempoGap(a, b float64) float64 {
+	return math.Min(math.Abs(a-b), math.Min(math.Abs(a-2*b), math.Abs(2*a-b)))
+}
+
+// DefaultBPMTolerance is how far apart two tempos may be and still mix when
+// Harmonic is not told otherwise.
+const DefaultBPMTolerance = 6.0
+
+// Harmonic chains tracks DJ-style: every next track is in a key compatible
+// with the last one and within BPMTolerance of its tempo. It opens with the
+// slowest track and, among compatible candidates, takes the closest by
+// Distance. When nothing is fully compatible it settles for a compatible key,
+// then a compatible tempo, then simply the closest track.
+type Harmonic struct {
+	BPMTolerance float64
+}
+
+func (h Harmonic) tolerance() float64 {
+	if h.BPMTolerance > 0 {
+		return h.BPMTolerance
+	}
+	return DefaultBPMTolerance
+}
+
+// Mixes reports whether b can follow a under h's rules.
+func (h Harmonic) Mixes(a, b Features) bool {
+	return KeyRelation(a, b) != KeyClash && TempoGap(a.Tempo, b.Tempo) <= h.tolerance()
+}
+
+func (h Harmonic) Order(tracks []Features) []int {
+	n := len(tracks)
+	if n == 0 {
+		return nil
+	}
+	start := 0
+	for i := range tracks {
+		if tracks[i].Tempo < tracks[start].Tempo {
+			start = i
+		}
+	}
+	used := make([]bool, n)
+	path := make([]int, 0, n)
+	path = append(path, start)
+	used[start] = true
+
+	tol := h.tolerance()
+	for len(path) < n {
+		last := tracks[path[len(path)-1]]
+		// Lower tier is better: 0 mixes, 1 key only, 2 tempo only, 3 neither
+		next, bestTier, bestDist := -1, 4, math.Inf(1)
+		for i := range tracks {
+			if used[i] {
+				continue
+			}
+			tier := 0
+			if KeyRelation(last, tracks[i]) == KeyClash {
+				tier += 2
+			}
+			if TempoGap(last.Tempo, tracks[i].Tempo) > tol {
+				tier++
+			}
+			d := Distance(last, tracks[i])
+			if tier < bestTier || tier == bestTier && d < bestDist {
+				next, bestTier, bestDist = i, tier, d
+			}
+		}
+		path = append(path, next)
+		used[next] = true
+	}
+	return path
+}
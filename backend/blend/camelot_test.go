@@ -0,0 +1,129 @@
+package blend
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCamelotKey(t *testing.T) {
+	// Spotify pitch classes: 0 = C, 1 = C#, ... 11 = B
+	tests := []struct {
+		key, mode int
+		want      string
+	}{
+		{0, 1, "8B"},  // C major
+		{7, 1, "9B"},  // G major
+		{4, 1, "12B"}, // E major
+		{11, 1, "1B"}, // B major wraps round from 12B
+		{6, 1, "2B"},  // F# major
+		{5, 1, "7B"},  // F major
+		{9, 0, "8A"},  // A minor, relative of C major
+		{4, 0, "9A"},  // E minor
+		{1, 0, "12A"}, // C# minor
+		{8, 0, "1A"},  // G# minor wraps round from 12A
+		{0, 0, "5A"},  // C minor
+		{2, 0, "7A"},  // D minor
+	}
+	for _, tt := range tests {
+		c, ok := CamelotKey(tt.key, tt.mode)
+		if !ok || c.String() != tt.want {
+			t.Errorf("CamelotKey(%d, %d) = %v, %v; want %s", tt.key, tt.mode, c, ok, tt.want)
+		}
+	}
+	for _, key := range []int{-1, 12} {
+		if _, ok := CamelotKey(key, 1); ok {
+			t.Errorf("CamelotKey(%d, 1) ok, want unknown", key)
+		}
+	}
+
+	// Every key lands on its own spot of the wheel
+	seen := make(map[string]bool)
+	for key := 0; key < 12; key++ {
+		for mode := 0; mode < 2; mode++ {
+			c, _ := CamelotKey(key, mode)
+			if c.Number < 1 || c.Number > 12 || seen[c.String()] {
+				t.Errorf("CamelotKey(%d, %d) = %s, out of range or taken", key, mode, c)
+			}
+			seen[c.String()] = true
+		}
+	}
+}
+
+func TestKeyRelation(t *testing.T) {
+	key := func(k, mode int) Features { return Features{Key: k, Mode: mode} }
+	tests := []struct {
+		name string
+		a, b Features
+		want string
+	}{
+		{"same key", key(0, 1), key(0, 1), SameKey},
+		{"relative minor", key(0, 1), key(9, 0), RelativeKey},
+		{"relative major", key(9, 0), key(0, 1), RelativeKey},
+		{"up a fifth", key(0, 1), key(7, 1), AdjacentKey},
+		{"down a fifth", key(0, 1), key(5, 1), AdjacentKey},
+		{"adjacent across 12 and 1", key(4, 1), key(11, 1), AdjacentKey},
+		{"adjacent minors", key(9, 0), key(4, 0), AdjacentKey},
+		{"diagonal", key(0, 1), key(4, 0), KeyClash},
+		{"two steps", key(0, 1), key(2, 1), KeyClash},
+		{"semitone", key(0, 1), key(1, 1), KeyClash},
+		{"unknown key", key(-1, 1), key(-1, 1), KeyClash},
+	}
+	for _, tt := range tests {
+		if got := KeyRelation(tt.a, tt.b); got != tt.want {
+			t.Errorf("%s: KeyRelation = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTempoGap(t *testing.T) {
+	tests := []struct {
+		a, b, want float64
+	}{
+		{120, 124, 4},
+		{124, 120, 4},
+		{70, 140, 0},
+		{140, 72, 4},
+		{90, 128, 38},
+	}
+	for _, tt := range tests {
+		if got := TempoGap(tt.a, tt.b); got != tt.want {
+			t.Errorf("TempoGap(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestHarmonicOrder(t *testing.T) {
+	// C major at 100 BPM opens. G major at 104 mixes at the default
+	// tolerance, but is far off in energy; G major at 108 is close in
+	// energy but only mixes once the tolerance allows 8 BPM.
+	tracks := []Features{
+		{Tempo: 108, Energy: 0.5, Key: 7, Mode: 1},
+		{Tempo: 100, Energy: 0.5, Key: 0, Mode: 1},
+		{Tempo: 104, Energy: 1.0, Key: 7, Mode: 1},
+	}
+	if got := (Harmonic{}).Order(tracks); !slices.Equal(got, []int{1, 2, 0}) {
+		t.Errorf("default tolerance: %v, want [1 2 0]", got)
+	}
+	if got := (Harmonic{BPMTolerance: 10}).Order(tracks); !slices.Equal(got, []int{1, 0, 2}) {
+		t.Errorf("tolerance 10: %v, want [1 0 2]", got)
+	}
+
+	// A compatible key beats a compatible tempo, which beats neither
+	tracks = []Features{
+		{Tempo: 100, Key: 0, Mode: 1},
+		{Tempo: 101, Key: 1, Mode: 1}, // clashes, tempo fine
+		{Tempo: 140, Key: 3, Mode: 1}, // clashes, tempo off
+		{Tempo: 130, Key: 9, Mode: 0}, // relative minor, tempo off
+	}
+	if got := (Harmonic{}).Order(tracks); got[1] != 3 {
+		t.Errorf("order %v, want the relative minor second", got)
+	}
+
+	h := Harmonic{BPMTolerance: 4}
+	if !h.Mixes(Features{Tempo: 120, Key: 0, Mode: 1}, Features{Tempo: 124, Key: 7, Mode: 1}) {
+		t.Error("adjacent keys 4 BPM apart don't mix at tolerance 4")
+	}
+	if h.Mixes(Features{Tempo: 120, Key: 0, Mode: 1}, Features{Tempo: 125, Key: 7, Mode: 1}) {
+		t.Error("5 BPM apart mix at tolerance 4")
+	}
+}
@@ -0,0 +1,95 @@
+package blend
+
+import (
+	"math/rand/v2"
+	"sort"
+)
+
+// Candidate is an artist reached from one or more seeds while walking the
+// related-artists graph. Distances maps each seed that reaches it to the
+// number of hops it took. Affinity is how much the listener likes the artist
+// already, 0 when unknown.
+type Candidate struct {
+	ID         string
+	Popularity int
+	Affinity   float64
+	Distances  map[string]int
+}
+
+// IsBridge reports whether the candidate connects at least two seeds, i.e.
+// sits between the selected artists rather than next to just one of them.
+func (c Candidate) IsBridge() bool {
+	return len(c.Distances) >= 2
+}
+
+// Score ranks candidates: one point per connected seed, plus a closeness
+// bonus below one point so that among equally connected artists the nearer
+// ones win.
+func (c Candidate) Score() float64 {
+	if len(c.Distances) == 0 {
+		return 0
+	}
+	closeness := 0.0
+	for _, d := range c.Distances {
+		closeness += 1 / float64(d+1)
+	}
+	return float64(len(c.Distances)) + closeness/float64(len(c.Distances))
+}
+
+// RankCandidates sorts cs best first: by score, then affinity, then
+// popularity, then ID so the order is stable across runs.
+func RankCandidates(cs []Candidate) {
+	sort.SliceStable(cs, func(i, j int) bool {
+		si, sj := cs[i].Score(), cs[j].Score()
+		if si != sj {
+			return si > sj
+		}
+		if cs[i].Affinity != cs[j].Affinity {
+			return cs[i].Affinity > cs[j].Affinity
+		}
+		if cs[i].Popularity != cs[j].Popularity {
+			return cs[i].Popularity > cs[j].Popularity
+		}
+		return cs[i].ID < cs[j].ID
+	})
+}
+
+// SampleCandidates picks n of the ranked candidates cs at random, weighted by
+// score, from the best 2n. The picks keep their rank order, so the result is
+// ranked too. When cs holds no more than n candidates they are all returned.
+func SampleCandidates(cs []Candidate, n int, rng *rand.Rand) []Candidate {
+	if len(cs) <= n {
+		return cs
+	}
+	if rng == nil {
+		return cs[:n]
+	}
+	pool := cs[:min(2*n, len(cs))]
+	picked := make([]bool, len(pool))
+	total := 0.0
+	for _, c := range pool {
+		total += c.Score()
+	}
+	for k := 0; k < n; k++ {
+		r := rng.Float64() * total
+		choice := -1
+		for i, c := range pool {
+			if picked[i] {
+				continue
+			}
+			choice = i
+			if r -= c.Score(); r < 0 {
+				break
+			}
+		}
+		picked[choice] = true
+		total -= pool[choice].Score()
+	}
+	out := make([]Candidate, 0, n)
+	for i, c := range pool {
+		if picked[i] {
+			out = append(out, c)
+		}
+	}
+	return out
+}
@@ -0,0 +1,62 @@
+// Package blend holds the Spotify-independent parts of building a blend:
+// how candidate tracks from several sources are mixed into one playlist.
+package blend
+
+// Bucket is one source of tracks (typically a seed artist) and the relative
+// share of the playlist it should receive.
+type Bucket[T any] struct {
+	Weight float64
+	Items  []T
+}
+
+// Interleaver draws items from buckets in proportion to their weights using
+// smooth weighted round-robin: every bucket accumulates its weight each step
+// and the one with the highest credit is served, so a 2:1 split comes out as
+// A B A A B A rather than A A B A A B. Equal weights reduce to plain
+// round-robin in bucket order. Exhausted buckets drop out and their share is
+// spread over the rest.
+type Interleaver[T any] struct {
+	buckets []Bucket[T]
+	credit  []float64
+	pos     []int
+	counts  []int
+}
+
+func NewInterleaver[T any](buckets []Bucket[T]) *Interleaver[T] {
+	return &Interleaver[T]{
+		buckets: buckets,
+		credit:  make([]float64, len(buckets)),
+		pos:     make([]int, len(buckets)),
+		counts:  make([]int, len(buckets)),
+	}
+}
+
+// Next returns the next item and the index of the bucket it came from. ok is
+// false once every bucket is exhausted.
+func (it *Interleaver[T]) Next() (item T, bucket int, ok bool) {
+	total := 0.0
+	best := -1
+	for i, b := range it.buckets {
+		if it.pos[i] >= len(b.Items) || b.Weight <= 0 {
+			continue
+		}
+		total += b.Weight
+		it.credit[i] += b.Weight
+		if best < 0 || it.credit[i] > it.credit[best] {
+			best = i
+		}
+	}
+	if best < 0 {
+		return item, -1, false
+	}
+	it.credit[best] -= total
+	item = it.buckets[best].Items[it.pos[best]]
+	it.pos[best]++
+	it.counts[best]++
+	return item, best, true
+}
+
+// Counts returns how many items have been drawn from each bucket so far.
+func (it *Interleaver[T]) Counts() []int {
+	return append([]int(nil), it.counts...)
+}
@@ -0,0 +1,118 @@
+package blend
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+// draw runs an interleaver over buckets of the given weights and sizes and
+// returns the bucket of each pick.
+func draw(weights []float64, sizes []int, n int) ([]int, *Interleaver[int]) {
+	buckets := make([]Bucket[int], len(weights))
+	for i, w := range weights {
+		buckets[i] = Bucket[int]{Weight: w, Items: make([]int, sizes[i])}
+	}
+	it := NewInterleaver(buckets)
+	var picks []int
+	for len(picks) < n {
+		_, b, ok := it.Next()
+		if !ok {
+			break
+		}
+		picks = append(picks, b)
+	}
+	return picks, it
+}
+
+func TestInterleaverSequence(t *testing.T) {
+	tests := []struct {
+		weights []float64
+		want    []int
+	}{
+		{[]float64{1, 1, 1}, []int{0, 1, 2, 0, 1, 2}},
+		{[]float64{2, 1}, []int{0, 1, 0, 0, 1, 0}},
+		{[]float64{1, 2}, []int{1, 0, 1, 1, 0, 1}},
+	}
+	for _, tt := range tests {
+		picks, _ := draw(tt.weights, []int{100, 100, 100}, len(tt.want))
+		if !slices.Equal(picks, tt.want) {
+			t.Errorf("weights %v: picks %v, want %v", tt.weights, picks, tt.want)
+		}
+	}
+}
+
+func TestInterleaverProportions(t *testing.T) {
+	tests := [][]float64{{1, 1}, {3, 2, 1}, {5, 1}, {0.5, 0.25, 0.25}}
+	for _, weights := range tests {
+		total := 0.0
+		for _, w := range weights {
+			total += w
+		}
+		const n = 1200
+		picks, it := draw(weights, []int{n, n, n}, n)
+		counts := it.Counts()
+		for i, w := range weights {
+			// Smooth round-robin is exact over each full cycle
+			if want := n * w / total; math.Abs(float64(counts[i])-want) > 1 {
+				t.Errorf("weights %v: bucket %d got %d of %d, want %.0f", weights, i, counts[i], n, want)
+			}
+
+			// Picks are spread out: a bucket never waits much longer than
+			// its share implies
+			maxGap := int(math.Ceil(total/w)) + 1
+			last := -1
+			for k, b := range picks {
+				if b != i {
+					continue
+				}
+				if k-last > maxGap {
+					t.Errorf("weights %v: bucket %d waited %d picks, want at most %d", weights, i, k-last, maxGap)
+					break
+				}
+				last = k
+			}
+		}
+	}
+}
+
+func TestInterleaverExhaustedBuckets(t *testing.T) {
+	// The heavy bucket runs out and the rest take over its share
+	picks, it := draw([]float64{5, 1, 1}, []int{2, 3, 3}, 100)
+	if want := []int{0, 0, 1, 2, 1, 2, 1, 2}; !slices.Equal(picks, want) {
+		t.Errorf("picks %v, want %v", picks, want)
+	}
+	if counts := it.Counts(); !slices.Equal(counts, []int{2, 3, 3}) {
+		t.Errorf("counts %v, want every item drawn", counts)
+	}
+	if _, b, ok := it.Next(); ok || b != -1 {
+		t.Errorf("Next after exhaustion = %d, %v; want -1, false", b, ok)
+	}
+
+	// Empty and weightless buckets are skipped
+	picks, _ = draw([]float64{1, 0, 1}, []int{0, 5, 2}, 100)
+	if want := []int{2, 2}; !slices.Equal(picks, want) {
+		t.Errorf("picks %v, want %v", picks, want)
+	}
+	if picks, _ := draw(nil, nil, 10); len(picks) != 0 {
+		t.Errorf("no buckets gave %v", picks)
+	}
+}
+
+func TestInterleaverItemOrder(t *testing.T) {
+	it := NewInterleaver([]Bucket[string]{
+		{Weight: 1, Items: []string{"a1", "a2"}},
+		{Weight: 1, Items: []string{"b1"}},
+	})
+	var got []string
+	for {
+		item, _, ok := it.Next()
+		if !ok {
+			break
+		}
+		got = append(got, item)
+	}
+	if want := []string{"a1", "b1", "a2"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
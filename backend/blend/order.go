@@ -0,0 +1,181 @@
+package blend
+
+import (
+	"math"
+	"sort"
+)
+
+// Features is what an Orderer knows about a track. Tempo is in BPM, Energy
+// and Valence run from 0 to 1. Key is a pitch class (0 = C) or -1 when
+// unknown, Mode is 1 for major and 0 for minor.
+type Features struct {
+	Tempo   float64
+	Energy  float64
+	Valence float64
+	Key     int
+	Mode    int
+}
+
+// Orderer arranges a playlist. Order gets one Features per track and returns
+// the track indices in playing order; every index must appear exactly once.
+type Orderer interface {
+	Order(tracks []Features) []int
+}
+
+// OrdererFunc adapts a plain function to Orderer.
+type OrdererFunc func(tracks []Features) []int
+
+func (f OrdererFunc) Order(tracks []Features) []int { return f(tracks) }
+
+var orderers = map[string]Orderer{
+	"smooth":    OrdererFunc(Smooth),
+	"build-up":  OrdererFunc(BuildUp),
+	"wind-down": OrdererFunc(WindDown),
+	"peak":      OrdererFunc(Peak),
+	"harmonic":  Harmonic{},
+}
+
+// RegisterOrderer makes o available under name, replacing any orderer
+// already registered with that name. It is meant to be called from init.
+func RegisterOrderer(name string, o Orderer) {
+	orderers[name] = o
+}
+
+// LookupOrderer returns the orderer registered under name.
+func LookupOrderer(name string) (Orderer, bool) {
+	o, ok := orderers[name]
+	return o, ok
+}
+
+// OrdererNames lists the registered orderers alphabetically.
+func OrdererNames() []string {
+	names := make([]string, 0, len(orderers))
+	for name := range orderers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// tempoScale is the tempo difference that counts as much as going from no
+// energy to full energy.
+const tempoScale = 60.0
+
+// Distance is how jarring it is to go from a to b: mostly tempo and energy,
+// with mood (valence) counting half.
+func Distance(a, b Features) float64 {
+	return math.Abs(a.Tempo-b.Tempo)/tempoScale +
+		math.Abs(a.Energy-b.Energy) +
+		0.5*math.Abs(a.Valence-b.Valence)
+}
+
+// intensity folds energy and tempo into one number for the energy arcs.
+func intensity(f Features) float64 {
+	return 0.7*f.Energy + 0.3*math.Min(f.Tempo/200, 1)
+}
+
+func identity(n int) []int {
+	idx := make([]int, n)
+	for i := range idx {
+		idx[i] = i
+	}
+	return idx
+}
+
+// Smooth starts from the calmest track and keeps moving to the closest
+// remaining one, then untangles the path with 2-opt so that no two
+// neighbours are further apart than they need to be.
+func Smooth(tracks []Features) []int {
+	n := len(tracks)
+	if n < 3 {
+		return identity(n)
+	}
+	start := 0
+	for i := range tracks {
+		if intensity(tracks[i]) < intensity(tracks[start]) {
+			start = i
+		}
+	}
+	used := make([]bool, n)
+	path := make([]int, 0, n)
+	path = append(path, start)
+	used[start] = true
+	for len(path) < n {
+		last := tracks[path[len(path)-1]]
+		next, best := -1, math.Inf(1)
+		for i := range tracks {
+			if used[i] {
+				continue
+			}
+			if d := Distance(last, tracks[i]); d < best {
+				next, best = i, d
+			}
+		}
+		path = append(path, next)
+		used[next] = true
+	}
+
+	// 2-opt on an open path: reversing path[i..j] swaps edges (i-1,i) and
+	// (j,j+1) for (i-1,j) and (i,j+1). The first track stays put.
+	dist := func(a, b int) float64 { return Distance(tracks[path[a]], tracks[path[b]]) }
+	for pass := 0; pass < 20; pass++ {
+		improved := false
+		for i := 1; i < n-1; i++ {
+			for j := i + 1; j < n; j++ {
+				before := dist(i-1, i)
+				after := dist(i-1, j)
+				if j+1 < n {
+					before += dist(j, j+1)
+					after += dist(i, j+1)
+				}
+				if after < before-1e-9 {
+					for l, r := i, j; l < r; l, r = l+1, r-1 {
+						path[l], path[r] = path[r], path[l]
+					}
+					improved = true
+				}
+			}
+		}
+		if !improved {
+			break
+		}
+	}
+	return path
+}
+
+// BuildUp orders tracks from calmest to most intense.
+func BuildUp(tracks []Features) []int {
+	idx := identity(len(tracks))
+	sort.SliceStable(idx, func(a, b int) bool {
+		return intensity(tracks[idx[a]]) < intensity(tracks[idx[b]])
+	})
+	return idx
+}
+
+// WindDown orders tracks from most intense to calmest.
+func WindDown(tracks []Features) []int {
+	idx := BuildUp(tracks)
+	for l, r := 0, len(idx)-1; l < r; l, r = l+1, r-1 {
+		idx[l], idx[r] = idx[r], idx[l]
+	}
+	return idx
+}
+
+// Peak rises to the most intense tracks in the middle and comes back down:
+// tracks are dealt alternately to the rising and falling halves.
+func Peak(tracks []Features) []int {
+	asc := BuildUp(tracks)
+	rise := make([]int, 0, (len(asc)+1)/2)
+	fall := make([]int, 0, len(asc)/2)
+	for i, t := range asc {
+		if i%2 == 0 {
+			rise = append(rise, t)
+		} else {
+			fall = append(fall, t)
+		}
+	}
+	for l, r := 0, len(fall)-1; l < r; l, r = l+1, r-1 {
+		fall[l], fall[r] = fall[r], fall[l]
+	}
+	return append(rise, fall...)
+}
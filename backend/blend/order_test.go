@@ -0,0 +1,133 @@
+package blend
+
+import (
+	"slices"
+	"testing"
+)
+
+// isPermutation reports whether order lists every index below n once.
+func isPermutation(order []int, n int) bool {
+	if len(order) != n {
+		return false
+	}
+	seen := make([]bool, n)
+	for _, i := range order {
+		if i < 0 || i >= n || seen[i] {
+			return false
+		}
+		seen[i] = true
+	}
+	return true
+}
+
+// sampleTracks makes n tracks with varied but reproducible features.
+func sampleTracks(n int) []Features {
+	tracks := make([]Features, n)
+	for i := range tracks {
+		tracks[i] = Features{
+			Tempo:   80 + float64(i*37%90),
+			Energy:  float64(i*53%100) / 100,
+			Valence: float64(i*29%100) / 100,
+			Key:     i * 5 % 12,
+			Mode:    i % 2,
+		}
+	}
+	return tracks
+}
+
+func TestOrderersPermute(t *testing.T) {
+	unknown := Features{Key: -1}
+	inputs := map[string][]Features{
+		"empty":     nil,
+		"one":       sampleTracks(1),
+		"two":       sampleTracks(2),
+		"identical": {{Tempo: 120, Energy: 0.5, Key: 1}, {Tempo: 120, Energy: 0.5, Key: 1}, {Tempo: 120, Energy: 0.5, Key: 1}},
+		"unknown":   {unknown, unknown, unknown},
+		"mixed":     append(sampleTracks(10), unknown, unknown),
+		"many":      sampleTracks(40),
+	}
+	for _, name := range OrdererNames() {
+		o, _ := LookupOrderer(name)
+		for input, tracks := range inputs {
+			order := o.Order(tracks)
+			if !isPermutation(order, len(tracks)) {
+				t.Errorf("%s on %s: %v is not a permutation of %d tracks", name, input, order, len(tracks))
+			}
+			if again := o.Order(tracks); !slices.Equal(again, order) {
+				t.Errorf("%s on %s: ordered %v, then %v", name, input, order, again)
+			}
+		}
+	}
+}
+
+func TestOrderersKeepTiesInPlace(t *testing.T) {
+	same := []Features{{Tempo: 120, Energy: 0.5}, {Tempo: 120, Energy: 0.5}, {Tempo: 120, Energy: 0.5}, {Tempo: 120, Energy: 0.5}}
+	for _, o := range []struct {
+		name string
+		fn   func([]Features) []int
+	}{{"BuildUp", BuildUp}, {"Smooth", Smooth}, {"Harmonic", Harmonic{}.Order}} {
+		if got := o.fn(same); !slices.Equal(got, []int{0, 1, 2, 3}) {
+			t.Errorf("%s on equal tracks = %v, want the input order", o.name, got)
+		}
+	}
+	if got := WindDown(same); !slices.Equal(got, []int{3, 2, 1, 0}) {
+		t.Errorf("WindDown on equal tracks = %v, want BuildUp reversed", got)
+	}
+
+	// Only the tied tracks keep their relative order
+	tracks := []Features{{Energy: 0.9}, {Energy: 0.2}, {Energy: 0.5}, {Energy: 0.2}}
+	if got := BuildUp(tracks); !slices.Equal(got, []int{1, 3, 2, 0}) {
+		t.Errorf("BuildUp = %v, want [1 3 2 0]", got)
+	}
+}
+
+func TestEnergyArcs(t *testing.T) {
+	tracks := []Features{{Energy: 0.5}, {Energy: 0.1}, {Energy: 0.9}, {Energy: 0.3}, {Energy: 0.7}}
+	if got := BuildUp(tracks); !slices.Equal(got, []int{1, 3, 0, 4, 2}) {
+		t.Errorf("BuildUp = %v", got)
+	}
+	if got := WindDown(tracks); !slices.Equal(got, []int{2, 4, 0, 3, 1}) {
+		t.Errorf("WindDown = %v", got)
+	}
+	// Peak deals 0.1, 0.5, 0.9 to the rise and 0.7, 0.3 to the fall
+	if got := Peak(tracks); !slices.Equal(got, []int{1, 0, 2, 4, 3}) {
+		t.Errorf("Peak = %v", got)
+	}
+}
+
+func TestOrderersWithMissingFeatures(t *testing.T) {
+	// Tracks without features carry zero values and no key
+	unknown := Features{Key: -1}
+	tracks := []Features{
+		{Tempo: 120, Energy: 0.8, Key: 0, Mode: 1},
+		unknown,
+		{Tempo: 122, Energy: 0.7, Key: 7, Mode: 1},
+		unknown,
+	}
+	// Nothing is calmer than a track without features, so they open
+	if got := BuildUp(tracks); !slices.Equal(got, []int{1, 3, 2, 0}) {
+		t.Errorf("BuildUp = %v, want the featureless tracks first", got)
+	}
+	// Unknown keys never mix, so harmonic order keeps the two known tracks
+	// together
+	got := Harmonic{}.Order(tracks)
+	if !isPermutation(got, len(tracks)) {
+		t.Fatalf("Harmonic = %v, not a permutation", got)
+	}
+	pos := make([]int, len(tracks))
+	for p, i := range got {
+		pos[i] = p
+	}
+	if d := pos[0] - pos[2]; d != 1 && d != -1 {
+		t.Errorf("Harmonic = %v, want the compatible tracks 0 and 2 adjacent", got)
+	}
+}
+
+func TestSmoothMinimisesJumps(t *testing.T) {
+	// Tempos along a line, shuffled: the smooth order walks the line from
+	// its calm end
+	tracks := []Features{{Tempo: 100, Energy: 0.4}, {Tempo: 80, Energy: 0.2}, {Tempo: 120, Energy: 0.6}, {Tempo: 90, Energy: 0.3}, {Tempo: 110, Energy: 0.5}}
+	if got := Smooth(tracks); !slices.Equal(got, []int{1, 3, 0, 4, 2}) {
+		t.Errorf("Smooth = %v, want [1 3 0 4 2]", got)
+	}
+}
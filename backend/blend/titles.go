@@ -0,0 +1,98 @@
+package blend
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// qualifierRe finds the parts of a track title that describe the version
+// rather than the song: anything in brackets and anything after a spaced
+// dash, as in "Song (Live)" or "Song - 2011 Remaster".
+var qualifierRe = regexp.MustCompile(`\(([^)]*)\)|\[([^\]]*)\]|\s[-–—]\s(.*)$`)
+
+// TitleQualifiers returns the lower-cased version qualifiers of title.
+func TitleQualifiers(title string) []string {
+	var out []string
+	for _, m := range qualifierRe.FindAllStringSubmatch(title, -1) {
+		for _, g := range m[1:] {
+			if g = strings.TrimSpace(g); g != "" {
+				out = append(out, strings.ToLower(g))
+			}
+		}
+	}
+	return out
+}
+
+var (
+	liveRe     = regexp.MustCompile(`\blive\b|\bin concert\b`)
+	remixRe    = regexp.MustCompile(`\bre-?mix(ed)?\b|\brmx\b|\bbootleg\b|\bmash-?up\b|\b(club|dub|extended|vip) mix\b`)
+	acousticRe = regexp.MustCompile(`\bacoustic\b|\bunplugged\b|\bstripped\b`)
+	// Live albums tend to say where they were recorded
+	liveAlbumRe = regexp.MustCompile(`\blive (at|from|in|on)\b|\bin concert\b`)
+)
+
+func anyQualifier(title string, re *regexp.Regexp) bool {
+	for _, q := range TitleQualifiers(title) {
+		if re.MatchString(q) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsLive guesses from the title whether a track is a live recording. Only the
+// qualifiers are looked at, so "Live Forever" is not live but
+// "Live Forever - Live at Knebworth" is.
+func IsLive(title string) bool { return anyQualifier(title, liveRe) }
+
+// IsLiveAlbum guesses from an album name whether it is a live album, e.g.
+// "Live at Leeds" or "Nevermind (Live)".
+func IsLiveAlbum(name string) bool {
+	return liveAlbumRe.MatchString(strings.ToLower(name)) || IsLive(name)
+}
+
+// IsRemix guesses from the title whether a track is a remix.
+func IsRemix(title string) bool { return anyQualifier(title, remixRe) }
+
+// IsAcoustic guesses from the title whether a track is an acoustic,
+// unplugged or stripped-back version.
+func IsAcoustic(title string) bool { return anyQualifier(title, acousticRe) }
+
+// versionNoiseRe matches qualifiers that relabel the same recording rather
+// than name a different one: remasters, edits, mono/stereo mixes, featured
+// artists and the like.
+var versionNoiseRe = regexp.MustCompile(`^(\d{4} )?(digital(ly)? )?remaster(ed)?( \d{4})?( version)?$|` +
+	`^(radio|single|album|original|clean|explicit|censored|uncensored|lp|7"|12") (edit|version|mix)$|` +
+	`^(mono|stereo)( version| mix)?$|^(feat|ft|featuring|with)\.? |^from .*$|^bonus track$|^deluxe( edition| version)?$|` +
+	`^\d{4} (version|mix|remaster(ed)?)$|^remaster(ed)? in \d{4}$`)
+
+// NormalizeTitle reduces a track title to a key that is equal for different
+// releases of the same recording: "Bohemian Rhapsody - Remastered 2011",
+// "Bohemian Rhapsody (Radio Edit)" and "bohemian rhapsody" all become
+// "bohemian rhapsody". Qualifiers marking a different recording, such as
+// "Live" or "Acoustic", are kept.
+func NormalizeTitle(title string) string {
+	title = qualifierRe.ReplaceAllStringFunc(title, func(m string) string {
+		for _, q := range TitleQualifiers(m) {
+			if !versionNoiseRe.MatchString(q) {
+				return " " + q + " "
+			}
+		}
+		return " "
+	})
+	var b strings.Builder
+	for _, r := range strings.ToLower(title) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+		case r == '&':
+			b.WriteString(" and ")
+		case r == '\'' || r == '’':
+			// "Don't" and "Dont" are the same song
+		default:
+			b.WriteRune(' ')
+		}
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
@@ -0,0 +1,82 @@
+package blend
+
+import "testing"
+
+func TestNormalizeTitle(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Bohemian Rhapsody", "bohemian rhapsody"},
+		{"Bohemian Rhapsody - Remastered 2011", "bohemian rhapsody"},
+		{"Bohemian Rhapsody (2011 Remaster)", "bohemian rhapsody"},
+		{"Stay (feat. Justin Bieber)", "stay"},
+		{"Stay (with Justin Bieber)", "stay"},
+		{"Mr. Brightside (Radio Edit)", "mr brightside"},
+		{"Mr. Brightside - Single Version", "mr brightside"},
+		{"Paint It Black - Mono Version", "paint it black"},
+		{"Song [Live at Wembley]", "song live at wembley"},
+		{"Song - Live at Wembley", "song live at wembley"},
+		{"Wonderwall (Acoustic)", "wonderwall acoustic"},
+		{"Wonderwall (Remix)", "wonderwall remix"},
+		{"DON'T STOP ME NOW", "dont stop me now"},
+		{"Don’t Stop Me Now", "dont stop me now"},
+		{"Rock & Roll", "rock and roll"},
+		{"Hello,   World!", "hello world"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeTitle(tt.in); got != tt.want {
+			t.Errorf("NormalizeTitle(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTitlePredicates(t *testing.T) {
+	tests := []struct {
+		in                    string
+		live, remix, acoustic bool
+	}{
+		{"Live Forever", false, false, false},
+		{"Live Forever - Live at Knebworth", true, false, false},
+		{"Song [Live]", true, false, false},
+		{"Song (In Concert)", true, false, false},
+		{"Song (Remix)", false, true, false},
+		{"Song - Club Mix", false, true, false},
+		{"Song (Extended Mix)", false, true, false},
+		{"Song - Radio Mix", false, false, false},
+		{"Remix Me", false, false, false},
+		{"Song (Acoustic)", false, false, true},
+		{"Song - Unplugged", false, false, true},
+		{"Song (Stripped)", false, false, true},
+		{"Song (Acoustic Live)", true, false, true},
+	}
+	for _, tt := range tests {
+		if got := IsLive(tt.in); got != tt.live {
+			t.Errorf("IsLive(%q) = %v, want %v", tt.in, got, tt.live)
+		}
+		if got := IsRemix(tt.in); got != tt.remix {
+			t.Errorf("IsRemix(%q) = %v, want %v", tt.in, got, tt.remix)
+		}
+		if got := IsAcoustic(tt.in); got != tt.acoustic {
+			t.Errorf("IsAcoustic(%q) = %v, want %v", tt.in, got, tt.acoustic)
+		}
+	}
+}
+
+func TestIsLiveAlbum(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"Live at Leeds", true},
+		{"Nevermind (Live)", true},
+		{"MTV Unplugged in New York", false},
+		{"Alive", false},
+		{"Live Through This", false},
+	}
+	for _, tt := range tests {
+		if got := IsLiveAlbum(tt.in); got != tt.want {
+			t.Errorf("IsLiveAlbum(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
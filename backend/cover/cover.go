@@ -0,0 +1,255 @@
+// Package cover draws playlist cover images: a collage of artist pictures,
+// or a gradient when there are none, with the playlist title across the
+// bottom.
+package cover
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"math"
+	"strings"
+	"unicode"
+)
+
+const (
+	// Size is the width and height of a cover in pixels.
+	Size = 640
+	// MaxPayload is Spotify's limit on an uploaded cover, which is sent
+	// base64-encoded.
+	MaxPayload = 256 * 1024
+
+	margin = 40
+	// maxTitleLines is how many lines the title may wrap onto.
+	maxTitleLines = 3
+	// Title dots are drawn between these sizes, as large as the title fits.
+	maxDot = 10
+	minDot = 4
+)
+
+// ErrTooLarge is returned when no quality setting gets a cover under
+// MaxPayload.
+var ErrTooLarge = errors.New("cover: image too large to upload")
+
+// Render draws a cover titled title from up to four images and returns it
+// JPEG-encoded, small enough to upload.
+func Render(title string, images []image.Image) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, Size, Size))
+	if len(images) == 0 {
+		gradient(img, title)
+	} else {
+		collage(img, images)
+	}
+	drawTitle(img, title)
+
+	var buf bytes.Buffer
+	for q := 90; q >= 30; q -= 10 {
+		buf.Reset()
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: q}); err != nil {
+			return nil, err
+		}
+		if base64.StdEncoding.EncodedLen(buf.Len()) <= MaxPayload {
+			return buf.Bytes(), nil
+		}
+	}
+	return nil, ErrTooLarge
+}
+
+// collage tiles dst with the images: one fills it, two split it down the
+// middle, three put one on the left and two stacked on the right, and four
+// make a grid.
+func collage(dst *image.RGBA, images []image.Image) {
+	h := Size / 2
+	var cells []image.Rectangle
+	switch len(images) {
+	case 1:
+		cells = []image.Rectangle{image.Rect(0, 0, Size, Size)}
+	case 2:
+		cells = []image.Rectangle{image.Rect(0, 0, h, Size), image.Rect(h, 0, Size, Size)}
+	case 3:
+		cells = []image.Rectangle{image.Rect(0, 0, h, Size), image.Rect(h, 0, Size, h), image.Rect(h, h, Size, Size)}
+	default:
+		cells = []image.Rectangle{image.Rect(0, 0, h, h), image.Rect(h, 0, Size, h), image.Rect(0, h, h, Size), image.Rect(h, h, Size, Size)}
+	}
+	for i, r := range cells {
+		fill(dst, r, images[i])
+	}
+}
+
+// fill scales src to cover r, cropping the overflow evenly from both sides.
+// Nearest-neighbour sampling is plenty for images Spotify already sizes.
+func fill(dst *image.RGBA, r image.Rectangle, src image.Image) {
+	b := src.Bounds()
+	if b.Empty() {
+		return
+	}
+	crop := b
+	if b.Dx()*r.Dy() > b.Dy()*r.Dx() {
+		w := b.Dy() * r.Dx() / r.Dy()
+		crop.Min.X += (b.Dx() - w) / 2
+		crop.Max.X = crop.Min.X + w
+	} else {
+		hgt := b.Dx() * r.Dy() / r.Dx()
+		crop.Min.Y += (b.Dy() - hgt) / 2
+		crop.Max.Y = crop.Min.Y + hgt
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		sy := crop.Min.Y + (y-r.Min.Y)*crop.Dy()/r.Dy()
+		for x := r.Min.X; x < r.Max.X; x++ {
+			sx := crop.Min.X + (x-r.Min.X)*crop.Dx()/r.Dx()
+			dst.Set(x, y, src.At(sx, sy))
+		}
+	}
+}
+
+// gradient paints a diagonal gradient whose colours are picked from title,
+// so the same title always gets the same cover.
+func gradient(dst *image.RGBA, title string) {
+	h := fnv.New32a()
+	h.Write([]byte(title))
+	hue := float64(h.Sum32() % 360)
+	from := hsv(hue, 0.7, 0.85)
+	to := hsv(math.Mod(hue+60, 360), 0.8, 0.35)
+	for y := 0; y < Size; y++ {
+		for x := 0; x < Size; x++ {
+			t := float64(x+y) / float64(2*(Size-1))
+			dst.SetRGBA(x, y, color.RGBA{
+				R: lerp(from.R, to.R, t),
+				G: lerp(from.G, to.G, t),
+				B: lerp(from.B, to.B, t),
+				A: 0xff,
+			})
+		}
+	}
+}
+
+func lerp(a, b uint8, t float64) uint8 {
+	return uint8(math.Round(float64(a) + (float64(b)-float64(a))*t))
+}
+
+// hsv converts a hue in degrees and saturation and value in [0, 1] to RGB.
+func hsv(h, s, v float64) color.RGBA {
+	c := v * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := v - c
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g, b = c, x, 0
+	case h < 120:
+		r, g, b = x, c, 0
+	case h < 180:
+		r, g, b = 0, c, x
+	case h < 240:
+		r, g, b = 0, x, c
+	case h < 300:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+	to8 := func(f float64) uint8 { return uint8(math.Round((f + m) * 255)) }
+	return color.RGBA{R: to8(r), G: to8(g), B: to8(b), A: 0xff}
+}
+
+// layoutTitle wraps title at word boundaries into at most maxTitleLines
+// lines, using the largest dot size at which it fits. A title that doesn't
+// fit even at minDot is cut short with an ellipsis.
+func layoutTitle(title string) ([]string, int) {
+	var words []string
+	for _, w := range strings.Fields(strings.ToUpper(title)) {
+		w = strings.Map(func(r rune) rune {
+			if _, ok := glyphs[r]; ok {
+				return r
+			}
+			return -1
+		}, w)
+		if w != "" {
+			words = append(words, w)
+		}
+	}
+	if len(words) == 0 {
+		return nil, 0
+	}
+	for dot := maxDot; dot >= minDot; dot-- {
+		if lines, ok := wrap(words, lineChars(dot)); ok && len(lines) <= maxTitleLines {
+			return lines, dot
+		}
+	}
+	// Break long words and drop what doesn't fit
+	n := lineChars(minDot)
+	all := strings.Join(words, " ")
+	var lines []string
+	for len(lines) < maxTitleLines && all != "" {
+		cut := min(n, len(all))
+		lines = append(lines, strings.TrimSpace(all[:cut]))
+		all = strings.TrimSpace(all[cut:])
+	}
+	if all != "" {
+		last := lines[len(lines)-1]
+		lines[len(lines)-1] = strings.TrimRightFunc(last[:min(len(last), n-3)], unicode.IsSpace) + "..."
+	}
+	return lines, minDot
+}
+
+// lineChars is how many glyphs fit across the cover at a dot size.
+func lineChars(dot int) int {
+	return (Size - 2*margin + dot) / (glyphAdvance * dot)
+}
+
+// wrap greedily fills lines of up to n glyphs. It fails if a word is longer
+// than a line.
+func wrap(words []string, n int) ([]string, bool) {
+	var lines []string
+	line := ""
+	for _, w := range words {
+		if len(w) > n {
+			return nil, false
+		}
+		switch {
+		case line == "":
+			line = w
+		case len(line)+1+len(w) <= n:
+			line += " " + w
+		default:
+			lines = append(lines, line)
+			line = w
+		}
+	}
+	return append(lines, line), true
+}
+
+// drawTitle writes the title in white across the bottom of dst over a
+// darkened band.
+func drawTitle(dst *image.RGBA, title string) {
+	lines, dot := layoutTitle(title)
+	if len(lines) == 0 {
+		return
+	}
+	textHeight := (len(lines)*lineAdvance - (lineAdvance - glyphHeight)) * dot
+	top := Size - margin - textHeight
+	band := image.Rect(0, top-margin, Size, Size)
+	draw.Draw(dst, band, image.NewUniform(color.RGBA{A: 0x99}), image.Point{}, draw.Over)
+
+	white := image.NewUniform(color.White)
+	for i, line := range lines {
+		y := top + i*lineAdvance*dot
+		for j, r := range line {
+			x := margin + j*glyphAdvance*dot
+			g := glyphs[r]
+			for row := 0; row < glyphHeight; row++ {
+				for col := 0; col < glyphWidth; col++ {
+					if g[row]&(1<<(glyphWidth-1-col)) == 0 {
+						continue
+					}
+					px := image.Rect(x+col*dot, y+row*dot, x+(col+1)*dot, y+(row+1)*dot)
+					draw.Draw(dst, px, white, image.Point{}, draw.Src)
+				}
+			}
+		}
+	}
+}
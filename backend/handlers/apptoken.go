@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// appTokenRefreshMargin is how long before expiry the cached app token is
+// replaced, so requests never go out with a token about to lapse.
+const appTokenRefreshMargin = 5 * time.Minute
+
+// appTokenCache holds the process-wide client-credentials token. Concurrent
+// callers that find it stale share a single in-flight fetch.
+type appTokenCache struct {
+	mu          sync.Mutex
+	token       string
+	expiresAt   time.Time
+	fetchedAt   time.Time
+	inflight    *appTokenCall
+	hits        int64
+	fetches     int64
+	lastError   string
+	lastErrorAt time.Time
+}
+
+type appTokenCall struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+var appTokens = &appTokenCache{}
+
+// Get returns the cached token, fetching a new one if it is missing or
+// within appTokenRefreshMargin of expiry.
+func (c *appTokenCache) Get(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	if c.token != "" && time.Until(c.expiresAt) > appTokenRefreshMargin {
+		c.hits++
+		token := c.token
+		c.mu.Unlock()
+		return token, nil
+	}
+	call := c.inflight
+	if call == nil {
+		call = &appTokenCall{done: make(chan struct{})}
+		c.inflight = call
+		go c.fetch(call)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.token, call.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// fetch runs detached from any one caller's context so a cancelled request
+// doesn't fail everyone else waiting on the same refresh.
+func (c *appTokenCache) fetch(call *appTokenCall) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	data := url.Values{}
+	data.Set("grant_type", "client_credentials")
+	tok, err := requestSpotifyToken(ctx, data)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fetches++
+	c.inflight = nil
+	if err != nil {
+		c.lastError = err.Error()
+		c.lastErrorAt = time.Now()
+		// Keep serving the old token while it is still technically valid
+		if c.token != "" && time.Now().Before(c.expiresAt) {
+			call.token = c.token
+		} else {
+			call.err = err
+		}
+	} else {
+		c.token = tok.AccessToken
+		c.expiresAt = tok.ExpiresAt()
+		c.fetchedAt = time.Now()
+		call.token = c.token
+	}
+	close(call.done)
+}
+
+type appTokenState struct {
+	Cached      bool       `json:"cached"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+	ExpiresIn   int        `json:"expiresInSeconds"`
+	FetchedAt   *time.Time `json:"fetchedAt,omitempty"`
+	Refreshing  bool       `json:"refreshing"`
+	Hits        int64      `json:"hits"`
+	Fetches     int64      `json:"fetches"`
+	LastError   string     `json:"lastError,omitempty"`
+	LastErrorAt *time.Time `json:"lastErrorAt,omitempty"`
+}
+
+// State reports the cache's current state. The token itself is never exposed.
+func (c *appTokenCache) State() appTokenState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st := appTokenState{
+		Cached:     c.token != "",
+		Refreshing: c.inflight != nil,
+		Hits:       c.hits,
+		Fetches:    c.fetches,
+		LastError:  c.lastError,
+	}
+	if c.token != "" {
+		expiresAt, fetchedAt := c.expiresAt, c.fetchedAt
+		st.ExpiresAt = &expiresAt
+		st.FetchedAt = &fetchedAt
+		if d := time.Until(c.expiresAt); d > 0 {
+			st.ExpiresIn = int(d.Seconds())
+		}
+	}
+	if !c.lastErrorAt.IsZero() {
+		lastErrorAt := c.lastErrorAt
+		st.LastErrorAt = &lastErrorAt
+	}
+	return st
+}
+
+// Helper: App-only access token via Client Credentials for public data
+func getAppAccessToken(ctx context.Context) (string, error) {
+	return appTokens.Get(ctx)
+}
+
+// AppTokenDebugHandler handles GET /api/debug/app-token
+func AppTokenDebugHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(appTokens.State())
+}
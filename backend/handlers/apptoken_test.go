@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAppTokenSingleFetch(t *testing.T) {
+	fake := useFakeSpotify()
+	fake.reset()
+	fake.mu.Lock()
+	fake.tokenDelay = 50 * time.Millisecond
+	fake.mu.Unlock()
+
+	cache := &appTokenCache{}
+	const callers = 20
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			token, err := cache.Get(context.Background())
+			if err != nil || token != "app-token" {
+				t.Errorf("Get = %q, %v", token, err)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	if n := len(fake.callsMatching(http.MethodPost, "/api/token")); n != 1 {
+		t.Errorf("%d callers made %d token requests, want 1", callers, n)
+	}
+	if st := cache.State(); st.Fetches != 1 || st.Refreshing {
+		t.Errorf("state %+v, want one finished fetch", st)
+	}
+}
+
+func TestAppTokenRefreshMargin(t *testing.T) {
+	fake := useFakeSpotify()
+
+	tests := []struct {
+		name      string
+		expiresIn time.Duration
+		want      string
+		fetches   int
+	}{
+		{"fresh", appTokenRefreshMargin + time.Minute, "cached", 0},
+		{"within the margin", appTokenRefreshMargin - time.Minute, "app-token", 1},
+		{"expired", -time.Minute, "app-token", 1},
+	}
+	for _, tt := range tests {
+		fake.reset()
+		cache := &appTokenCache{token: "cached", expiresAt: time.Now().Add(tt.expiresIn)}
+		token, err := cache.Get(context.Background())
+		if err != nil || token != tt.want {
+			t.Errorf("%s: Get = %q, %v; want %q", tt.name, token, err, tt.want)
+		}
+		if n := len(fake.callsMatching(http.MethodPost, "/api/token")); n != tt.fetches {
+			t.Errorf("%s: %d token requests, want %d", tt.name, n, tt.fetches)
+		}
+	}
+}
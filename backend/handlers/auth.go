@@ -3,8 +3,7 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"fmt"
-	"io"
+	"log"
 	"net/http"
 	"net/url"
 	"os"
@@ -55,13 +54,29 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	scopes := "user-read-email playlist-read-private playlist-modify-private playlist-modify-public"
-	authURL := fmt.Sprintf(
-		"https://accounts.spotify.com/authorize?client_id=%s&response_type=code&redirect_uri=%s&scope=%s&show_dialog=true",
-		clientID,
-		url.QueryEscape(getSpotifyRedirectURI()),
-		url.QueryEscape(scopes),
-	)
+	flow, err := newOAuthFlow(r.URL.Query().Get("return_to"))
+	if err != nil {
+		http.Error(w, "Failed to start login", http.StatusInternalServerError)
+		return
+	}
+	setOAuthCookie(w, flow)
+
+	scopes := "user-read-email playlist-read-private playlist-read-collaborative playlist-modify-private playlist-modify-public user-library-read user-read-recently-played ugc-image-upload"
+	if personalizationEnabled() {
+		scopes += " user-top-read"
+	}
+	params := url.Values{}
+	params.Set("client_id", clientID)
+	params.Set("response_type", "code")
+	params.Set("redirect_uri", getSpotifyRedirectURI())
+	params.Set("scope", scopes)
+	params.Set("state", flow.State())
+	params.Set("show_dialog", "true")
+	if flow.CodeVerifier != "" {
+		params.Set("code_challenge_method", "S256")
+		params.Set("code_challenge", pkceChallenge(flow.CodeVerifier))
+	}
+	authURL := spotifyAPI().AuthorizeURL(params)
 	http.Redirect(w, r, authURL, http.StatusFound)
 }
 
@@ -74,6 +89,14 @@ func CallbackHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The state must match the nonce cookie set by LoginHandler (login CSRF)
+	flow, err := verifyOAuthState(r)
+	clearOAuthCookie(w)
+	if err != nil {
+		http.Error(w, "Invalid OAuth state", http.StatusBadRequest)
+		return
+	}
+
 	code := r.URL.Query().Get("code")
 	if code == "" {
 		http.Error(w, "No code in request", http.StatusBadRequest)
@@ -85,62 +108,28 @@ func CallbackHandler(w http.ResponseWriter, r *http.Request) {
 	data.Set("grant_type", "authorization_code")
 	data.Set("code", code)
 	data.Set("redirect_uri", getSpotifyRedirectURI())
-	// Per Spotify API, use Basic auth header for token exchange
-	tokenReq, _ := http.NewRequest("POST", "https://accounts.spotify.com/api/token", strings.NewReader(data.Encode()))
-	tokenReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	tokenReq.SetBasicAuth(clientID, clientSecret)
-	resp, err := http.DefaultClient.Do(tokenReq)
-	if err != nil {
-		http.Error(w, "Failed to get token", http.StatusInternalServerError)
-		return
+	if flow.CodeVerifier != "" {
+		data.Set("code_verifier", flow.CodeVerifier)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		http.Error(w, "Token endpoint returned non-200 status", http.StatusBadGateway)
-		return
-	}
-
-	var tokenData map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&tokenData); err != nil {
-		http.Error(w, "Failed to parse token response", http.StatusInternalServerError)
-		return
-	}
-
-	accessToken, _ := tokenData["access_token"].(string)
-	refreshToken, _ := tokenData["refresh_token"].(string)
-	if accessToken == "" {
-		http.Error(w, "Missing access token in response", http.StatusBadGateway)
+	tok, err := requestSpotifyToken(r.Context(), data)
+	if err != nil {
+		log.Printf("Token exchange failed: %v", err)
+		http.Error(w, "Failed to get token", http.StatusBadGateway)
 		return
 	}
+	accessToken := tok.AccessToken
+	refreshToken := tok.RefreshToken
 
 	// Fetch user profile
-	req, _ := http.NewRequest("GET", "https://api.spotify.com/v1/me", nil)
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	userResp, err := http.DefaultClient.Do(req)
+	profile, err := spotifyAPI().Me(r.Context(), accessToken)
 	if err != nil {
-		fmt.Printf("Error fetching user profile: %v\n", err)
-		http.Error(w, "Failed to fetch user profile", http.StatusInternalServerError)
+		log.Printf("Error fetching user profile: %v", err)
+		http.Error(w, "Failed to fetch user profile", http.StatusBadGateway)
 		return
 	}
-	defer userResp.Body.Close()
 
-	if userResp.StatusCode < 200 || userResp.StatusCode >= 300 {
-		body, _ := io.ReadAll(userResp.Body)
-		fmt.Printf("Spotify profile API error: status %d, body: %s\n", userResp.StatusCode, string(body))
-		http.Error(w, "Spotify profile API error", http.StatusBadGateway)
-		return
-	}
-
-	var profile map[string]interface{}
-	if err := json.NewDecoder(userResp.Body).Decode(&profile); err != nil {
-		fmt.Printf("Error decoding user profile: %v\n", err)
-		http.Error(w, "Failed to decode user profile", http.StatusInternalServerError)
-		return
-	}
-
-	spotifyID, _ := profile["id"].(string)
-	email, _ := profile["email"].(string)
+	spotifyID := profile.ID
+	email := profile.Email
 	if spotifyID == "" {
 		http.Error(w, "Failed to read Spotify user id", http.StatusBadGateway)
 		return
@@ -152,12 +141,13 @@ func CallbackHandler(w http.ResponseWriter, r *http.Request) {
 	defer cancel()
 
 	user := models.User{
-		SpotifyID:    spotifyID,
-		Email:        email,
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		CreatedAt:    time.Now(),
-		UpdatedAt:    time.Now(),
+		SpotifyID:      spotifyID,
+		Email:          email,
+		AccessToken:    accessToken,
+		RefreshToken:   refreshToken,
+		TokenExpiresAt: tok.ExpiresAt(),
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
 	}
 
 	filter := bson.M{"spotify_id": spotifyID}
@@ -169,85 +159,45 @@ func CallbackHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Set session cookie with spotify_id
-	secure, sameSite := getCookiePolicy()
-	http.SetCookie(w, &http.Cookie{
-		Name:     "ab_sid",
-		Value:    spotifyID,
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   secure,
-		SameSite: sameSite,
-		MaxAge:   60 * 60 * 24 * 7, // 7 days
-	})
+	// Rotate the session: drop whatever session the browser had and issue a fresh one
+	if c, err := r.Cookie(sessionCookieName); err == nil && c.Value != "" {
+		if err := deleteSession(ctx, c.Value); err != nil {
+			log.Printf("Failed to revoke previous session: %v", err)
+		}
+	}
+	sessionToken, err := createSession(ctx, spotifyID)
+	if err != nil {
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+	setSessionCookie(w, sessionToken)
 
-	// Redirect back to frontend with success flag
-	redirectTo := fmt.Sprintf("%s/?auth=success", getFrontendBaseURL())
+	// Redirect back to the page the user came from with success flag
+	redirectTo := getFrontendBaseURL() + withQueryParam(flow.ReturnTo, "auth", "success")
 	http.Redirect(w, r, redirectTo, http.StatusFound)
 }
 
 func LogoutHandler(w http.ResponseWriter, r *http.Request) {
-	// Clear cookie
-	secure, sameSite := getCookiePolicy()
-	http.SetCookie(w, &http.Cookie{
-		Name:     "ab_sid",
-		Value:    "",
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   secure,
-		SameSite: sameSite,
-		MaxAge:   -1,
-	})
+	// Revoke the server-side session, then clear the cookie
+	if c, err := r.Cookie(sessionCookieName); err == nil && c.Value != "" {
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+		if err := deleteSession(ctx, c.Value); err != nil {
+			http.Error(w, "failed to revoke session", http.StatusInternalServerError)
+			return
+		}
+	}
+	clearSessionCookie(w)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(`{"ok":true}`))
 }
 
-// MeHandler: simple auth check using cookie
+// MeHandler: returns the user resolved by RequireUser
 func MeHandler(w http.ResponseWriter, r *http.Request) {
-	c, err := r.Cookie("ab_sid")
-	if err != nil || c.Value == "" {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
-		return
-	}
+	user := currentUser(r)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"spotify_id": c.Value})
-}
-
-// Helper: App-only access token via Client Credentials for public data
-func getAppAccessToken() (string, error) {
-	clientID := os.Getenv("SPOTIFY_CLIENT_ID")
-	clientSecret := os.Getenv("SPOTIFY_CLIENT_SECRET")
-	if clientID == "" || clientSecret == "" {
-		return "", fmt.Errorf("missing Spotify credentials")
-	}
-
-	data := url.Values{}
-	data.Set("grant_type", "client_credentials")
-
-	req, _ := http.NewRequest("POST", "https://accounts.spotify.com/api/token", strings.NewReader(data.Encode()))
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.SetBasicAuth(clientID, clientSecret)
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return "", fmt.Errorf("token endpoint status %d", resp.StatusCode)
-	}
-
-	var tokenData map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&tokenData); err != nil {
-		return "", err
-	}
-	token, _ := tokenData["access_token"].(string)
-	if token == "" {
-		return "", fmt.Errorf("missing access_token in response")
-	}
-	return token, nil
+	json.NewEncoder(w).Encode(map[string]string{"spotify_id": user.SpotifyID, "email": user.Email})
 }
 
 // SearchArtistsHandler handles GET /api/search/artists?q=
@@ -258,31 +208,19 @@ func SearchArtistsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := getAppAccessToken()
+	token, err := getAppAccessToken(r.Context())
 	if err != nil {
-		http.Error(w, "failed to acquire app token", http.StatusInternalServerError)
+		writeSpotifyError(w, err, "failed to acquire app token")
 		return
 	}
 
 	// Call Spotify Search API
-	searchURL := fmt.Sprintf("https://api.spotify.com/v1/search?type=artist&limit=10&q=%s", url.QueryEscape(q))
-	req, _ := http.NewRequest("GET", searchURL, nil)
-	req.Header.Set("Authorization", "Bearer "+token)
-	resp, err := http.DefaultClient.Do(req)
+	page, err := spotifyAPI().SearchArtists(r.Context(), token, q, 10)
 	if err != nil {
-		http.Error(w, "failed to call Spotify search", http.StatusBadGateway)
-		return
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		http.Error(w, "Spotify search error", http.StatusBadGateway)
+		writeSpotifyError(w, err, "Spotify search error")
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	if _, err := io.Copy(w, resp.Body); err != nil {
-		http.Error(w, "failed to stream response", http.StatusInternalServerError)
-		return
-	}
+	json.NewEncoder(w).Encode(map[string]any{"artists": page})
 }
@@ -0,0 +1,337 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"strings"
+
+	"github.com/Git-HimanshuRathi/artist-blend/backend/spotify"
+)
+
+const (
+	// maxCatalogueAlbums caps how far back into an artist's releases a blend
+	// digs when top tracks run out.
+	maxCatalogueAlbums = 100
+	// relatedPerSeed is how many related artists each seed contributes when
+	// the seeds' own catalogue can't fill the playlist.
+	relatedPerSeed = 3
+)
+
+// abortsBlend reports whether a Spotify error should fail the whole blend
+// rather than just drop the artist it happened for.
+func abortsBlend(err error) bool {
+	return errors.Is(err, spotify.ErrThrottled) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+type resolvedSeed struct {
+	ID     string
+	Name   string
+	Weight float64
+	Images []spotify.Image
+}
+
+// artistResolution tells the caller which Spotify artist an input mapped to.
+type artistResolution struct {
+	Input     string `json:"input"`
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	MatchedBy string `json:"matchedBy"` // "id", "exact" or "search"
+	Used      bool   `json:"used"`
+}
+
+type seedResolution struct {
+	Seeds      []resolvedSeed
+	Resolved   []artistResolution
+	Unresolved []string
+}
+
+// isSpotifyID reports whether id looks like a base-62 Spotify ID. Malformed
+// IDs make Spotify reject a whole batch, so they are filtered out first.
+func isSpotifyID(id string) bool {
+	if len(id) != 22 {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+func normalizeArtistName(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), " ")
+}
+
+// bestArtistMatch picks the search result for name: the most popular exact
+// (case and whitespace insensitive) match if there is one, otherwise
+// Spotify's top hit.
+func bestArtistMatch(name string, items []spotify.Artist) (*spotify.Artist, string) {
+	want := normalizeArtistName(name)
+	var best *spotify.Artist
+	for i := range items {
+		a := &items[i]
+		if a.ID == "" || normalizeArtistName(a.Name) != want {
+			continue
+		}
+		if best == nil || a.Popularity > best.Popularity {
+			best = a
+		}
+	}
+	if best != nil {
+		return best, "exact"
+	}
+	for i := range items {
+		if items[i].ID != "" {
+			return &items[i], "search"
+		}
+	}
+	return nil, ""
+}
+
+// resolveSeeds maps every input onto a Spotify artist, by ID when one is
+// given and by name search otherwise (or when the ID is unknown). The first
+// max distinct artists, in input order, become seeds; an artist named twice
+// keeps one seed carrying the combined weight.
+func resolveSeeds(ctx context.Context, token string, inputs []artistInput, weights []float64, max int) (*seedResolution, error) {
+	found := make([]*spotify.Artist, len(inputs))
+	matchedBy := make([]string, len(inputs))
+
+	// Look up explicit IDs in batches of 50
+	var idIdx []int
+	for i, in := range inputs {
+		if isSpotifyID(strings.TrimSpace(in.ID)) {
+			idIdx = append(idIdx, i)
+		}
+	}
+	var batches [][]int
+	for start := 0; start < len(idIdx); start += 50 {
+		batches = append(batches, idIdx[start:min(start+50, len(idIdx))])
+	}
+	err := fanOut(ctx, len(batches), spotifyConcurrency, func(ctx context.Context, b int) error {
+		ids := make([]string, len(batches[b]))
+		for j, i := range batches[b] {
+			ids[j] = strings.TrimSpace(inputs[i].ID)
+		}
+		artists, err := spotifyAPI().Artists(ctx, token, ids)
+		if err != nil {
+			if abortsBlend(err) {
+				return err
+			}
+			return nil
+		}
+		byID := make(map[string]*spotify.Artist, len(artists))
+		for k := range artists {
+			byID[artists[k].ID] = &artists[k]
+		}
+		for j, i := range batches[b] {
+			if a := byID[ids[j]]; a != nil {
+				found[i] = a
+				matchedBy[i] = "id"
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Fall back to searching by name for everything else
+	err = fanOut(ctx, len(inputs), spotifyConcurrency, func(ctx context.Context, i int) error {
+		n := strings.TrimSpace(inputs[i].Name)
+		if found[i] != nil || n == "" {
+			return nil
+		}
+		page, err := spotifyAPI().SearchArtists(ctx, token, n, 10)
+		if err != nil {
+			if abortsBlend(err) {
+				return err
+			}
+			return nil
+		}
+		found[i], matchedBy[i] = bestArtistMatch(n, page.Items)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := &seedResolution{}
+	byID := make(map[string]int)
+	for i, a := range found {
+		input := strings.TrimSpace(inputs[i].Name)
+		if input == "" {
+			input = strings.TrimSpace(inputs[i].ID)
+		}
+		if a == nil {
+			if input != "" {
+				res.Unresolved = append(res.Unresolved, input)
+			}
+			continue
+		}
+		r := artistResolution{Input: input, ID: a.ID, Name: a.Name, MatchedBy: matchedBy[i]}
+		if j, ok := byID[a.ID]; ok {
+			res.Seeds[j].Weight += weights[i]
+			r.Used = true
+		} else if len(res.Seeds) < max {
+			byID[a.ID] = len(res.Seeds)
+			res.Seeds = append(res.Seeds, resolvedSeed{ID: a.ID, Name: a.Name, Weight: weights[i], Images: a.Images})
+			r.Used = true
+		}
+		res.Resolved = append(res.Resolved, r)
+	}
+	return res, nil
+}
+
+// fetchTopTracks loads each artist's top tracks concurrently. The result is
+// indexed like artistIDs; artists whose lookup failed get a nil slice.
+func fetchTopTracks(ctx context.Context, token string, artistIDs []string) ([][]spotify.Track, error) {
+	out := make([][]spotify.Track, len(artistIDs))
+	err := fanOut(ctx, len(artistIDs), spotifyConcurrency, func(ctx context.Context, i int) error {
+		tracks, err := spotifyAPI().ArtistTopTracks(ctx, token, artistIDs[i], defaultMarket)
+		if err != nil {
+			if abortsBlend(err) {
+				return err
+			}
+			return nil
+		}
+		out[i] = tracks
+		return nil
+	})
+	return out, err
+}
+
+func hasArtist(t spotify.Track, artistID string) bool {
+	for _, a := range t.Artists {
+		if a.ID == artistID {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchCatalogueTracks walks an artist's albums and singles (newest first)
+// and returns up to need tracks the artist performs on. Album tracks come
+// back without their album, so it is filled in from the parent.
+func fetchCatalogueTracks(ctx context.Context, token, artistID string, need int) ([]spotify.Track, error) {
+	var tracks []spotify.Track
+	for offset := 0; offset < maxCatalogueAlbums; offset += 50 {
+		page, err := spotifyAPI().ArtistAlbums(ctx, token, artistID, spotify.ArtistAlbumsOptions{
+			IncludeGroups: []string{"album", "single"},
+			Market:        defaultMarket,
+			Limit:         50,
+			Offset:        offset,
+		})
+		if err != nil {
+			return tracks, err
+		}
+		ids := make([]string, 0, len(page.Items))
+		for _, a := range page.Items {
+			ids = append(ids, a.ID)
+		}
+		for start := 0; start < len(ids); start += 20 {
+			end := min(start+20, len(ids))
+			albums, err := spotifyAPI().Albums(ctx, token, ids[start:end], defaultMarket)
+			if err != nil {
+				return tracks, err
+			}
+			for _, al := range albums {
+				if al.Tracks == nil {
+					continue
+				}
+				parent := al
+				parent.Tracks = nil
+				for _, t := range al.Tracks.Items {
+					if !hasArtist(t, artistID) {
+						continue
+					}
+					t.Album = parent
+					tracks = append(tracks, t)
+					if len(tracks) >= need {
+						return tracks, nil
+					}
+				}
+			}
+		}
+		if page.Next == "" {
+			break
+		}
+	}
+	return tracks, nil
+}
+
+// deepenPools tops up every pool that holds fewer than needs[i] tracks with
+// tracks from that artist's albums that pass filter, sampled at random from
+// twice as many as are missing, or taken in catalogue order when rng is nil.
+// Lookup failures leave the pool as is.
+func deepenPools(ctx context.Context, token string, artistIDs []string, pools [][]spotify.Track, needs []int, rng *rand.Rand, filter *trackFilter) error {
+	extras := make([][]spotify.Track, len(artistIDs))
+	err := fanOut(ctx, len(artistIDs), spotifyConcurrency, func(ctx context.Context, i int) error {
+		missing := needs[i] - len(pools[i])
+		if missing <= 0 {
+			return nil
+		}
+		extra, err := fetchCatalogueTracks(ctx, token, artistIDs[i], 2*missing+len(pools[i]))
+		if err != nil && abortsBlend(err) {
+			return err
+		}
+		extras[i] = extra
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// Sample in pool order once everything is in, so the draws depend only
+	// on the seed and not on which fetch finished first
+	for i, extra := range extras {
+		extra = filter.apply(extra)
+		if rng != nil {
+			rng.Shuffle(len(extra), func(a, b int) { extra[a], extra[b] = extra[b], extra[a] })
+		}
+		missing := needs[i] - len(pools[i])
+		pools[i] = append(pools[i], extra[:min(max(missing, 0), len(extra))]...)
+	}
+	return nil
+}
+
+// fetchRelatedPools returns top tracks of artists related to the seeds, one
+// pool per related artist, skipping the seeds themselves.
+func fetchRelatedPools(ctx context.Context, token string, seeds []resolvedSeed) ([][]spotify.Track, error) {
+	related := make([][]spotify.Artist, len(seeds))
+	err := fanOut(ctx, len(seeds), spotifyConcurrency, func(ctx context.Context, i int) error {
+		artists, err := spotifyAPI().RelatedArtists(ctx, token, seeds[i].ID)
+		if err != nil {
+			if abortsBlend(err) {
+				return err
+			}
+			return nil
+		}
+		related[i] = artists
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	taken := make(map[string]bool)
+	for _, s := range seeds {
+		taken[s.ID] = true
+	}
+	var ids []string
+	for _, artists := range related {
+		n := 0
+		for _, a := range artists {
+			if n >= relatedPerSeed {
+				break
+			}
+			if taken[a.ID] {
+				continue
+			}
+			taken[a.ID] = true
+			ids = append(ids, a.ID)
+			n++
+		}
+	}
+	return fetchTopTracks(ctx, token, ids)
+}
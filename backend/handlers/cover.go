@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Git-HimanshuRathi/artist-blend/backend/cover"
+	"github.com/Git-HimanshuRathi/artist-blend/backend/models"
+	"github.com/Git-HimanshuRathi/artist-blend/backend/spotify"
+)
+
+const (
+	// coverTimeout bounds making and uploading a cover. A cover is a
+	// nicety, so it mustn't hold up the response for long.
+	coverTimeout = 15 * time.Second
+	// coverArtists is how many seed artists' pictures go into a collage.
+	coverArtists = 4
+	// maxCoverSourceBytes caps the artist pictures we download.
+	maxCoverSourceBytes = 4 << 20
+)
+
+// artistPicture picks the smallest of an artist's images that is still at
+// least size pixels wide, or the largest if none is.
+func artistPicture(images []spotify.Image, size int) string {
+	best := -1
+	for i, img := range images {
+		switch {
+		case best < 0:
+			best = i
+		case images[best].Width < size:
+			if img.Width > images[best].Width {
+				best = i
+			}
+		case img.Width >= size && img.Width < images[best].Width:
+			best = i
+		}
+	}
+	if best < 0 {
+		return ""
+	}
+	return images[best].URL
+}
+
+func fetchImage(ctx context.Context, url string) (image.Image, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", url, resp.Status)
+	}
+	img, _, err := image.Decode(io.LimitReader(resp.Body, maxCoverSourceBytes))
+	return img, err
+}
+
+// playlistCover renders a cover titled title from pictures of the first few
+// artists. Artists that can't be found or pictured are left out; with none
+// left the cover is a gradient.
+func playlistCover(ctx context.Context, title string, artists []artistInput) ([]byte, error) {
+	var pictures []image.Image
+	if len(artists) > 0 {
+		token, err := getAppAccessToken(ctx)
+		if err != nil {
+			return nil, err
+		}
+		weights := make([]float64, len(artists))
+		res, err := resolveSeeds(ctx, token, artists, weights, coverArtists)
+		if err != nil {
+			return nil, err
+		}
+		if len(res.Seeds) == 0 {
+			return cover.Render(title, nil)
+		}
+		// Resolving fetched the artists already, pictures included
+		fetched := make([]image.Image, len(res.Seeds))
+		fanOut(ctx, len(res.Seeds), spotifyConcurrency, func(ctx context.Context, i int) error {
+			if url := artistPicture(res.Seeds[i].Images, cover.Size/2); url != "" {
+				fetched[i], _ = fetchImage(ctx, url)
+			}
+			return nil
+		})
+		for _, img := range fetched {
+			if img != nil {
+				pictures = append(pictures, img)
+			}
+		}
+	}
+	return cover.Render(title, pictures)
+}
+
+// uploadPlaylistCover makes a cover for a new playlist and sets it on
+// Spotify.
+func uploadPlaylistCover(ctx context.Context, user *models.User, playlistID, title string, artists []artistInput) error {
+	ctx, cancel := context.WithTimeout(ctx, coverTimeout)
+	defer cancel()
+	img, err := playlistCover(ctx, title, artists)
+	if err != nil {
+		return err
+	}
+	return withUserToken(ctx, user, func(token string) error {
+		return spotifyAPI().UploadPlaylistCover(ctx, token, playlistID, img)
+	})
+}
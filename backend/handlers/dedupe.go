@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"github.com/Git-HimanshuRathi/artist-blend/backend/blend"
+	"github.com/Git-HimanshuRathi/artist-blend/backend/spotify"
+)
+
+// trackDeduper keeps a blend free of repeats. Besides the track ID it
+// matches tracks by ISRC and by normalised title plus primary artist, so the
+// same recording on a single, an album and a compilation counts once.
+type trackDeduper struct {
+	seen map[string]struct{}
+	// best holds the preferred release per key, see prefer.
+	best map[string]spotify.Track
+}
+
+func newTrackDeduper() *trackDeduper {
+	return &trackDeduper{seen: make(map[string]struct{}), best: make(map[string]spotify.Track)}
+}
+
+// dedupeKeys are the identities a track is matched on.
+func dedupeKeys(t spotify.Track) []string {
+	keys := []string{"id:" + t.ID}
+	if t.ExternalIDs.ISRC != "" {
+		keys = append(keys, "isrc:"+t.ExternalIDs.ISRC)
+	}
+	if len(t.Artists) > 0 {
+		if title := blend.NormalizeTitle(t.Name); title != "" {
+			keys = append(keys, "title:"+t.Artists[0].ID+":"+title)
+		}
+	}
+	return keys
+}
+
+func albumRank(a spotify.Album) int {
+	switch a.AlbumType {
+	case "album":
+		return 0
+	case "single":
+		return 1
+	case "compilation":
+		return 3
+	}
+	return 2
+}
+
+// betterRelease reports whether a is the preferable release of a recording:
+// album tracks beat singles beat compilations, then the earliest release
+// wins, then the cleaner title.
+func betterRelease(a, b spotify.Track) bool {
+	if ra, rb := albumRank(a.Album), albumRank(b.Album); ra != rb {
+		return ra < rb
+	}
+	if a.Album.ReleaseDate != b.Album.ReleaseDate && a.Album.ReleaseDate != "" && b.Album.ReleaseDate != "" {
+		return a.Album.ReleaseDate < b.Album.ReleaseDate
+	}
+	if qa, qb := len(blend.TitleQualifiers(a.Name)), len(blend.TitleQualifiers(b.Name)); qa != qb {
+		return qa < qb
+	}
+	return a.ID < b.ID
+}
+
+// prefer registers candidate releases so that add can swap a track for the
+// preferred release of the same recording.
+func (d *trackDeduper) prefer(pools ...[]spotify.Track) {
+	for _, pool := range pools {
+		for _, t := range pool {
+			if t.ID == "" {
+				continue
+			}
+			for _, k := range dedupeKeys(t)[1:] {
+				if cur, ok := d.best[k]; !ok || betterRelease(t, cur) {
+					d.best[k] = t
+				}
+			}
+		}
+	}
+}
+
+// add appends to dst the tracks in pool that aren't repeats, each replaced by
+// its preferred release, and marks them seen.
+func (d *trackDeduper) add(dst, pool []spotify.Track) []spotify.Track {
+	for _, t := range pool {
+		if t.ID == "" {
+			continue
+		}
+		rep := t
+		for _, k := range dedupeKeys(t)[1:] {
+			if b, ok := d.best[k]; ok && betterRelease(b, rep) {
+				rep = b
+			}
+		}
+		keys := append(dedupeKeys(t), dedupeKeys(rep)...)
+		dup := false
+		for _, k := range keys {
+			if _, ok := d.seen[k]; ok {
+				dup = true
+				break
+			}
+		}
+		if dup {
+			continue
+		}
+		for _, k := range keys {
+			d.seen[k] = struct{}{}
+		}
+		dst = append(dst, rep)
+	}
+	return dst
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/Git-HimanshuRathi/artist-blend/backend/spotify"
+)
+
+func release(id, name, albumType, date string) spotify.Track {
+	return spotify.Track{ID: id, Name: name, Album: spotify.Album{AlbumType: albumType, ReleaseDate: date}}
+}
+
+func TestBetterRelease(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b spotify.Track
+		want bool
+	}{
+		{"album beats single", release("2", "Song", "album", "2020"), release("1", "Song", "single", "2019"), true},
+		{"single beats unknown type", release("2", "Song", "single", "2020"), release("1", "Song", "", "2019"), true},
+		{"unknown type beats compilation", release("2", "Song", "", "2020"), release("1", "Song", "compilation", "2019"), true},
+		{"compilation loses to album", release("1", "Song", "compilation", "2001"), release("2", "Song", "album", "2020"), false},
+		{"earlier release wins", release("2", "Song", "album", "1975-10-31"), release("1", "Song", "album", "2011"), true},
+		{"later release loses", release("1", "Song", "album", "2011"), release("2", "Song", "album", "1975"), false},
+		{"missing date falls through to title", release("2", "Song", "album", ""), release("1", "Song - Remastered 2011", "album", "1975"), true},
+		{"fewer qualifiers win", release("2", "Song", "album", "1975"), release("1", "Song (Mono) - Remastered", "album", "1975"), true},
+		{"more qualifiers lose", release("1", "Song (Radio Edit)", "album", "1975"), release("2", "Song", "album", "1975"), false},
+		{"lower ID breaks a tie", release("1", "Song", "album", "1975"), release("2", "Song", "album", "1975"), true},
+		{"higher ID loses a tie", release("2", "Song", "album", "1975"), release("1", "Song", "album", "1975"), false},
+	}
+	for _, tt := range tests {
+		if got := betterRelease(tt.a, tt.b); got != tt.want {
+			t.Errorf("%s: betterRelease = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"context"
+	"math/rand/v2"
+
+	"github.com/Git-HimanshuRathi/artist-blend/backend/blend"
+	"github.com/Git-HimanshuRathi/artist-blend/backend/spotify"
+)
+
+const (
+	defaultDiscoveryDepth   = 1
+	maxDiscoveryDepth       = 3
+	defaultDiscoveryFanOut  = 5
+	maxDiscoveryFanOut      = 10
+	defaultDiscoveryArtists = 5
+	maxDiscoveryArtists     = 20
+	defaultDiscoveryRatio   = 0.3
+	maxDiscoveryRatio       = 0.9
+	// maxDiscoveryLookups bounds related-artist calls for one blend.
+	maxDiscoveryLookups = 150
+)
+
+// discoveryOptions turns on discovery mode: besides the seeds themselves the
+// blend mixes in artists found by walking Spotify's related artists.
+type discoveryOptions struct {
+	// Depth is how many related-artist hops to walk from each seed.
+	Depth int `json:"depth,omitempty" bson:"depth,omitempty"`
+	// FanOut is how many related artists are followed from each artist.
+	FanOut int `json:"fanOut,omitempty" bson:"fan_out,omitempty"`
+	// Artists is how many discovered artists make it into the blend.
+	Artists int `json:"artists,omitempty" bson:"artists,omitempty"`
+	// Ratio is the share of the playlist given to discovered artists.
+	Ratio float64 `json:"ratio,omitempty" bson:"ratio,omitempty"`
+}
+
+func (o *discoveryOptions) normalize() error {
+	if o.Depth == 0 {
+		o.Depth = defaultDiscoveryDepth
+	}
+	if o.FanOut == 0 {
+		o.FanOut = defaultDiscoveryFanOut
+	}
+	if o.Artists == 0 {
+		o.Artists = defaultDiscoveryArtists
+	}
+	if o.Ratio == 0 {
+		o.Ratio = defaultDiscoveryRatio
+	}
+	switch {
+	case o.Depth < 1 || o.Depth > maxDiscoveryDepth:
+		return badRequest("discovery.depth must be between 1 and %d", maxDiscoveryDepth)
+	case o.FanOut < 1 || o.FanOut > maxDiscoveryFanOut:
+		return badRequest("discovery.fanOut must be between 1 and %d", maxDiscoveryFanOut)
+	case o.Artists < 1 || o.Artists > maxDiscoveryArtists:
+		return badRequest("discovery.artists must be between 1 and %d", maxDiscoveryArtists)
+	case o.Ratio <= 0 || o.Ratio > maxDiscoveryRatio:
+		return badRequest("discovery.ratio must be above 0 and at most %.1f", maxDiscoveryRatio)
+	}
+	return nil
+}
+
+// discoveredArtist is reported back for every artist discovery mode added.
+type discoveredArtist struct {
+	Artist         string   `json:"artist"`
+	ArtistID       string   `json:"artistId"`
+	ConnectedSeeds []string `json:"connectedSeeds"`
+	Bridge         bool     `json:"bridge"`
+	Score          float64  `json:"score"`
+	Tracks         int      `json:"tracks"`
+}
+
+// walkRelated does a breadth-first walk of the related-artists graph from
+// every seed, depth hops deep and width artists wide, and returns each artist
+// reached with its distance to every seed that reaches it. taste, if not nil,
+// breaks ties between equally connected artists.
+func walkRelated(ctx context.Context, token string, seeds []resolvedSeed, depth, width int, taste *userTaste) ([]blend.Candidate, map[string]spotify.Artist, error) {
+	isSeed := make(map[string]bool)
+	frontier := make([][]string, len(seeds))
+	visited := make([]map[string]bool, len(seeds))
+	for i, s := range seeds {
+		isSeed[s.ID] = true
+		frontier[i] = []string{s.ID}
+		visited[i] = map[string]bool{s.ID: true}
+	}
+
+	related := make(map[string][]spotify.Artist)
+	artists := make(map[string]spotify.Artist)
+	distances := make(map[string]map[string]int)
+	lookups := 0
+
+	for d := 1; d <= depth; d++ {
+		// Fetch every frontier artist once, however many seeds reach it
+		var pending []string
+		queued := make(map[string]bool)
+		for _, ids := range frontier {
+			for _, id := range ids {
+				if _, ok := related[id]; ok || queued[id] || lookups >= maxDiscoveryLookups {
+					continue
+				}
+				queued[id] = true
+				pending = append(pending, id)
+				lookups++
+			}
+		}
+		results := make([][]spotify.Artist, len(pending))
+		err := fanOut(ctx, len(pending), spotifyConcurrency, func(ctx context.Context, i int) error {
+			rel, err := spotifyAPI().RelatedArtists(ctx, token, pending[i])
+			if err != nil {
+				if abortsBlend(err) {
+					return err
+				}
+				return nil
+			}
+			results[i] = rel
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		for i, id := range pending {
+			related[id] = results[i]
+		}
+
+		for si, ids := range frontier {
+			var next []string
+			for _, id := range ids {
+				rel := related[id]
+				if len(rel) > width {
+					rel = rel[:width]
+				}
+				for _, a := range rel {
+					if a.ID == "" || isSeed[a.ID] || visited[si][a.ID] {
+						continue
+					}
+					visited[si][a.ID] = true
+					next = append(next, a.ID)
+					artists[a.ID] = a
+					if distances[a.ID] == nil {
+						distances[a.ID] = make(map[string]int)
+					}
+					distances[a.ID][seeds[si].ID] = d
+				}
+			}
+			frontier[si] = next
+		}
+	}
+
+	candidates := make([]blend.Candidate, 0, len(distances))
+	for id, dist := range distances {
+		candidates = append(candidates, blend.Candidate{
+			ID:         id,
+			Popularity: artists[id].Popularity,
+			Affinity:   taste.artistAffinity(id),
+			Distances:  dist,
+		})
+	}
+	blend.RankCandidates(candidates)
+	return candidates, artists, nil
+}
+
+// discoverArtists picks well-connected artists around the seeds, favouring
+// the best connected, and loads their top tracks. Pools are indexed like the
+// returned artists.
+func discoverArtists(ctx context.Context, token string, seeds []resolvedSeed, opts *discoveryOptions, rng *rand.Rand, taste *userTaste) ([]discoveredArtist, []blend.Candidate, [][]spotify.Track, error) {
+	candidates, artists, err := walkRelated(ctx, token, seeds, opts.Depth, opts.FanOut, taste)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	candidates = blend.SampleCandidates(candidates, opts.Artists, rng)
+
+	seedNames := make(map[string]string)
+	for _, s := range seeds {
+		seedNames[s.ID] = s.Name
+	}
+	found := make([]discoveredArtist, len(candidates))
+	ids := make([]string, len(candidates))
+	for i, c := range candidates {
+		ids[i] = c.ID
+		found[i] = discoveredArtist{
+			Artist:   artists[c.ID].Name,
+			ArtistID: c.ID,
+			Bridge:   c.IsBridge(),
+			Score:    c.Score(),
+		}
+		// Report connected seeds in seed order
+		for _, s := range seeds {
+			if _, ok := c.Distances[s.ID]; ok {
+				found[i].ConnectedSeeds = append(found[i].ConnectedSeeds, seedNames[s.ID])
+			}
+		}
+	}
+	pools, err := fetchTopTracks(ctx, token, ids)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return found, candidates, pools, nil
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+)
+
+// spotifyConcurrency bounds how many Spotify calls one request runs at once.
+const spotifyConcurrency = 4
+
+// fanOut runs fn for every index in [0, n) on at most limit goroutines. The
+// first error cancels the context passed to the remaining calls and is
+// returned once all started calls have finished. fn should write its result
+// into a slot owned by i, which keeps the output order independent of
+// scheduling.
+func fanOut(ctx context.Context, n, limit int, fn func(ctx context.Context, i int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	sem := make(chan struct{}, limit)
+	for i := 0; i < n; i++ {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := fn(ctx, i); err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(i)
+	}
+	wg.Wait()
+	if firstErr == nil {
+		// Parent cancelled (e.g. client went away) before everything ran
+		firstErr = ctx.Err()
+	}
+	return firstErr
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/Git-HimanshuRathi/artist-blend/backend/blend"
+	"github.com/Git-HimanshuRathi/artist-blend/backend/spotify"
+)
+
+// trackFilters constrains which candidate tracks a blend may use. Zero values
+// leave a bound off.
+type trackFilters struct {
+	ExcludeExplicit    bool `json:"excludeExplicit,omitempty" bson:"exclude_explicit,omitempty"`
+	MinDurationSeconds int  `json:"minDurationSeconds,omitempty" bson:"min_duration_seconds,omitempty"`
+	MaxDurationSeconds int  `json:"maxDurationSeconds,omitempty" bson:"max_duration_seconds,omitempty"`
+	MinYear            int  `json:"minYear,omitempty" bson:"min_year,omitempty"`
+	MaxYear            int  `json:"maxYear,omitempty" bson:"max_year,omitempty"`
+	// Spotify only reports popularity for top tracks. Album tracks come back
+	// with none, so tracks without one pass both bounds.
+	MinPopularity   int  `json:"minPopularity,omitempty" bson:"min_popularity,omitempty"`
+	MaxPopularity   int  `json:"maxPopularity,omitempty" bson:"max_popularity,omitempty"`
+	ExcludeLive     bool `json:"excludeLive,omitempty" bson:"exclude_live,omitempty"`
+	ExcludeRemix    bool `json:"excludeRemix,omitempty" bson:"exclude_remix,omitempty"`
+	ExcludeAcoustic bool `json:"excludeAcoustic,omitempty" bson:"exclude_acoustic,omitempty"`
+}
+
+func (f *trackFilters) validate() error {
+	maxYear := time.Now().Year() + 1
+	switch {
+	case f.MinDurationSeconds < 0 || f.MaxDurationSeconds < 0:
+		return badRequest("filters: durations must not be negative")
+	case f.MaxDurationSeconds > 0 && f.MinDurationSeconds > f.MaxDurationSeconds:
+		return badRequest("filters.minDurationSeconds must not exceed maxDurationSeconds")
+	case f.MinYear != 0 && (f.MinYear < 1900 || f.MinYear > maxYear),
+		f.MaxYear != 0 && (f.MaxYear < 1900 || f.MaxYear > maxYear):
+		return badRequest("filters: years must be between 1900 and %d", maxYear)
+	case f.MaxYear != 0 && f.MinYear > f.MaxYear:
+		return badRequest("filters.minYear must not exceed maxYear")
+	case f.MinPopularity < 0 || f.MinPopularity > 100 || f.MaxPopularity < 0 || f.MaxPopularity > 100:
+		return badRequest("filters: popularity must be between 0 and 100")
+	case f.MaxPopularity != 0 && f.MinPopularity > f.MaxPopularity:
+		return badRequest("filters.minPopularity must not exceed maxPopularity")
+	}
+	return nil
+}
+
+// releaseYear reads the year off an album's release date, which Spotify
+// gives as YYYY, YYYY-MM or YYYY-MM-DD.
+func releaseYear(a spotify.Album) (int, bool) {
+	if len(a.ReleaseDate) < 4 {
+		return 0, false
+	}
+	y, err := strconv.Atoi(a.ReleaseDate[:4])
+	return y, err == nil
+}
+
+// rejects names the first filter t fails, or "" when t passes them all.
+func (f *trackFilters) rejects(t spotify.Track) string {
+	secs := t.DurationMs / 1000
+	switch {
+	case f.ExcludeExplicit && t.Explicit:
+		return "explicit"
+	case f.MinDurationSeconds > 0 && secs < f.MinDurationSeconds,
+		f.MaxDurationSeconds > 0 && secs > f.MaxDurationSeconds:
+		return "duration"
+	case t.Popularity > 0 && f.MinPopularity > 0 && t.Popularity < f.MinPopularity,
+		t.Popularity > 0 && f.MaxPopularity > 0 && t.Popularity > f.MaxPopularity:
+		return "popularity"
+	case f.ExcludeLive && (blend.IsLive(t.Name) || blend.IsLiveAlbum(t.Album.Name)):
+		return "live"
+	case f.ExcludeRemix && blend.IsRemix(t.Name):
+		return "remix"
+	case f.ExcludeAcoustic && blend.IsAcoustic(t.Name):
+		return "acoustic"
+	}
+	if f.MinYear != 0 || f.MaxYear != 0 {
+		y, ok := releaseYear(t.Album)
+		if !ok || f.MinYear != 0 && y < f.MinYear || f.MaxYear != 0 && y > f.MaxYear {
+			return "year"
+		}
+	}
+	return ""
+}
+
+// trackFilter applies trackFilters and, in fresh-only mode, the user's
+// library to candidate pools and counts how many tracks each filter removed.
+// A nil *trackFilter keeps everything.
+type trackFilter struct {
+	opts    *trackFilters
+	library *userLibrary
+	removed map[string]int
+}
+
+func newTrackFilter(opts *trackFilters, library *userLibrary) *trackFilter {
+	if opts == nil && library == nil {
+		return nil
+	}
+	return &trackFilter{opts: opts, library: library, removed: make(map[string]int)}
+}
+
+// apply filters pool in place. It is not safe for concurrent use.
+func (f *trackFilter) apply(pool []spotify.Track) []spotify.Track {
+	if f == nil {
+		return pool
+	}
+	kept := pool[:0]
+	for _, t := range pool {
+		if f.library != nil && f.library.has(t) {
+			f.removed["library"]++
+			continue
+		}
+		if f.opts != nil {
+			if reason := f.opts.rejects(t); reason != "" {
+				f.removed[reason]++
+				continue
+			}
+		}
+		kept = append(kept, t)
+	}
+	return kept
+}
+
+// counts returns the removals per filter, or nil without filters.
+func (f *trackFilter) counts() map[string]int {
+	if f == nil {
+		return nil
+	}
+	return f.removed
+}
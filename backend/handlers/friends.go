@@ -0,0 +1,433 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Git-HimanshuRathi/artist-blend/backend/blend"
+	"github.com/Git-HimanshuRathi/artist-blend/backend/config"
+	"github.com/Git-HimanshuRathi/artist-blend/backend/models"
+	"github.com/Git-HimanshuRathi/artist-blend/backend/spotify"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	inviteTTL = 7 * 24 * time.Hour
+
+	defaultFriendBlendLength = 30
+	maxFriendBlendLength     = 100
+	// friendTopArtists is how many of each user's top artists contribute
+	// their own top tracks besides the user's top tracks.
+	friendTopArtists = 5
+
+	// sharedTaste attributes a track to both users.
+	sharedTaste = "both"
+)
+
+// blendInvite is a link one user sends another to start a friend blend.
+type blendInvite struct {
+	Code       string     `bson:"_id" json:"code"`
+	From       string     `bson:"from_spotify_id" json:"from"`
+	Length     int        `bson:"length" json:"length"`
+	CreatedAt  time.Time  `bson:"created_at" json:"createdAt"`
+	ExpiresAt  time.Time  `bson:"expires_at" json:"expiresAt"`
+	AcceptedBy string     `bson:"accepted_by,omitempty" json:"acceptedBy,omitempty"`
+	AcceptedAt *time.Time `bson:"accepted_at,omitempty" json:"acceptedAt,omitempty"`
+	BlendID    string     `bson:"blend_id,omitempty" json:"blendId,omitempty"`
+}
+
+// friendTrack is a track of a friend blend and whose taste it came from: a
+// member's Spotify ID, or "both".
+type friendTrack struct {
+	simplifiedTrack `bson:",inline"`
+	From            string `bson:"from" json:"from"`
+}
+
+type friendBlend struct {
+	ID        string        `bson:"_id,omitempty" json:"id"`
+	InviteID  string        `bson:"invite_id" json:"inviteId"`
+	Members   []string      `bson:"members" json:"members"`
+	Tracks    []friendTrack `bson:"tracks" json:"tracks"`
+	Seed      int64         `bson:"seed" json:"seed"`
+	CreatedAt time.Time     `bson:"created_at" json:"createdAt"`
+}
+
+// EnsureFriendIndexes expires stale invites and indexes blends by member.
+func EnsureFriendIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := config.DB.Collection("blend_invites").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		{Keys: bson.D{{Key: "from_spotify_id", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = config.DB.Collection("friend_blends").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "members", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+	return err
+}
+
+func newInviteCode() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// loadUser fetches a stored user by Spotify ID.
+func loadUser(ctx context.Context, spotifyID string) (*models.User, error) {
+	var user models.User
+	err := config.DB.Collection("users").FindOne(ctx, bson.M{"spotify_id": spotifyID}).Decode(&user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// friendTaste is one member's side of a friend blend.
+type friendTaste struct {
+	user    *models.User
+	artists []spotify.Artist
+	tracks  []spotify.Track
+}
+
+// loadFriendTaste pulls a member's top artists and tracks with their own
+// token.
+func loadFriendTaste(ctx context.Context, user *models.User) (*friendTaste, error) {
+	taste := &friendTaste{user: user}
+	err := withUserToken(ctx, user, func(token string) error {
+		artists, err := spotifyAPI().TopArtists(ctx, token, spotify.MediumTerm, 20)
+		if err != nil {
+			return err
+		}
+		tracks, err := spotifyAPI().TopTracks(ctx, token, spotify.MediumTerm, 50)
+		if err != nil {
+			return err
+		}
+		taste.artists, taste.tracks = artists.Items, tracks.Items
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return taste, nil
+}
+
+// generateFriendBlend balances two members' tastes: each gets an equal
+// share of their own top tracks and their top artists' top tracks, and
+// tracks or artists both have in common go in a shared bucket of the same
+// weight, attributed to both.
+func generateFriendBlend(ctx context.Context, a, b *models.User, length int, seed int64) ([]friendTrack, error) {
+	tastes := make([]*friendTaste, 2)
+	for i, u := range []*models.User{a, b} {
+		t, err := loadFriendTaste(ctx, u)
+		if spotify.IsStatus(err, http.StatusForbidden) {
+			// Don't tell one member another's Spotify ID
+			msg := "your friend needs to log in again"
+			if u == b {
+				msg = "log in again to share your top artists"
+			}
+			return nil, &requestError{status: http.StatusForbidden, msg: msg}
+		}
+		if err != nil {
+			return nil, err
+		}
+		tastes[i] = t
+	}
+
+	token, err := getAppAccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var artistIDs []string
+	for _, t := range tastes {
+		for i, ar := range t.artists {
+			if i >= friendTopArtists {
+				break
+			}
+			artistIDs = append(artistIDs, ar.ID)
+		}
+	}
+	artistPools, err := fetchTopTracks(ctx, token, artistIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	rng := newBlendRand(seed)
+	pools := make([][]spotify.Track, 2)
+	next := 0
+	for i, t := range tastes {
+		pools[i] = append(pools[i], t.tracks...)
+		for j := 0; j < min(friendTopArtists, len(t.artists)); j++ {
+			pools[i] = append(pools[i], artistPools[next]...)
+			next++
+		}
+		rng.Shuffle(len(pools[i]), func(x, y int) { pools[i][x], pools[i][y] = pools[i][y], pools[i][x] })
+	}
+
+	// What both members like: shared top tracks and tracks by shared artists
+	likedBy := func(t *friendTaste) map[string]bool {
+		m := make(map[string]bool)
+		for _, ar := range t.artists {
+			m["artist:"+ar.ID] = true
+		}
+		for _, tr := range t.tracks {
+			m["track:"+tr.ID] = true
+		}
+		return m
+	}
+	likes := []map[string]bool{likedBy(tastes[0]), likedBy(tastes[1])}
+	both := func(t spotify.Track) bool {
+		if likes[0]["track:"+t.ID] && likes[1]["track:"+t.ID] {
+			return true
+		}
+		for _, ar := range t.Artists {
+			if likes[0]["artist:"+ar.ID] && likes[1]["artist:"+ar.ID] {
+				return true
+			}
+		}
+		return false
+	}
+	var shared []spotify.Track
+	for i := range pools {
+		own := pools[i][:0]
+		for _, t := range pools[i] {
+			if both(t) {
+				shared = append(shared, t)
+			} else {
+				own = append(own, t)
+			}
+		}
+		pools[i] = own
+	}
+
+	dedupe := newTrackDeduper()
+	dedupe.prefer(shared)
+	dedupe.prefer(pools...)
+	buckets := []blend.Bucket[spotify.Track]{
+		{Weight: 1, Items: dedupe.add(nil, shared)},
+		{Weight: 1, Items: dedupe.add(nil, pools[0])},
+		{Weight: 1, Items: dedupe.add(nil, pools[1])},
+	}
+	from := []string{sharedTaste, a.SpotifyID, b.SpotifyID}
+	var out []friendTrack
+	it := blend.NewInterleaver(buckets)
+	for len(out) < length {
+		t, bucket, ok := it.Next()
+		if !ok {
+			break
+		}
+		out = append(out, friendTrack{simplifiedTrack: toSimplifiedTrack(t), From: from[bucket]})
+	}
+	return out, nil
+}
+
+// POST /api/friends/invites
+func CreateInviteHandler(w http.ResponseWriter, r *http.Request) {
+	if !personalizationEnabled() {
+		http.Error(w, "friend blends are not enabled", http.StatusNotFound)
+		return
+	}
+	var body struct {
+		Length int `json:"length"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	if body.Length == 0 {
+		body.Length = defaultFriendBlendLength
+	}
+	if body.Length < minPlaylistLength || body.Length > maxFriendBlendLength {
+		http.Error(w, fmt.Sprintf("length must be between %d and %d", minPlaylistLength, maxFriendBlendLength), http.StatusBadRequest)
+		return
+	}
+	code, err := newInviteCode()
+	if err != nil {
+		http.Error(w, "failed to create invite", http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	invite := blendInvite{
+		Code:      code,
+		From:      currentUser(r).SpotifyID,
+		Length:    body.Length,
+		CreatedAt: now,
+		ExpiresAt: now.Add(inviteTTL),
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+	if _, err := config.DB.Collection("blend_invites").InsertOne(ctx, invite); err != nil {
+		http.Error(w, "failed to create invite", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		blendInvite
+		URL string `json:"url"`
+	}{invite, getFrontendBaseURL() + "/blend/invite/" + code})
+}
+
+// GET /api/friends/invites/:code
+func GetInviteHandler(w http.ResponseWriter, r *http.Request) {
+	if !personalizationEnabled() {
+		http.Error(w, "friend blends are not enabled", http.StatusNotFound)
+		return
+	}
+	code := strings.TrimPrefix(r.URL.Path, "/api/friends/invites/")
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+	var invite blendInvite
+	err := config.DB.Collection("blend_invites").FindOne(ctx, bson.M{"_id": code, "expires_at": bson.M{"$gt": time.Now()}}).Decode(&invite)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		http.Error(w, "invite not found or expired", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invite)
+}
+
+// POST /api/friends/invites/:code/accept
+func AcceptInviteHandler(w http.ResponseWriter, r *http.Request) {
+	if !personalizationEnabled() {
+		http.Error(w, "friend blends are not enabled", http.StatusNotFound)
+		return
+	}
+	code := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/friends/invites/"), "/accept")
+	user := currentUser(r)
+	invites := config.DB.Collection("blend_invites")
+
+	ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
+	defer cancel()
+
+	// Claim the invite so two people can't accept it at once
+	now := time.Now()
+	var invite blendInvite
+	err := invites.FindOneAndUpdate(ctx, bson.M{
+		"_id":             code,
+		"expires_at":      bson.M{"$gt": now},
+		"from_spotify_id": bson.M{"$ne": user.SpotifyID},
+		"accepted_by":     bson.M{"$exists": false},
+	}, bson.M{"$set": bson.M{"accepted_by": user.SpotifyID, "accepted_at": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&invite)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		http.Error(w, "invite not found, expired or already used", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to accept invite", http.StatusInternalServerError)
+		return
+	}
+	// release hands the invite back when the blend can't be made. The
+	// request context may be what failed, so it gets its own.
+	release := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_, err := invites.UpdateOne(ctx, bson.M{"_id": code, "accepted_by": user.SpotifyID},
+			bson.M{"$unset": bson.M{"accepted_by": "", "accepted_at": ""}})
+		if err != nil {
+			log.Printf("friends: failed to release invite %s: %v", code, err)
+		}
+	}
+
+	inviter, err := loadUser(ctx, invite.From)
+	if err != nil {
+		release()
+		http.Error(w, "inviter no longer available", http.StatusGone)
+		return
+	}
+	seed := newBlendSeed()
+	tracks, err := generateFriendBlend(ctx, inviter, user, invite.Length, seed)
+	if err != nil {
+		release()
+		writeBlendError(w, err)
+		return
+	}
+
+	fb := friendBlend{
+		InviteID:  code,
+		Members:   []string{inviter.SpotifyID, user.SpotifyID},
+		Tracks:    tracks,
+		Seed:      seed,
+		CreatedAt: time.Now(),
+	}
+	res, err := config.DB.Collection("friend_blends").InsertOne(ctx, fb)
+	if err != nil {
+		release()
+		http.Error(w, "failed to save blend", http.StatusInternalServerError)
+		return
+	}
+	fb.ID = res.InsertedID.(primitive.ObjectID).Hex()
+	invites.UpdateOne(ctx, bson.M{"_id": code}, bson.M{"$set": bson.M{"blend_id": fb.ID}})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(fb)
+}
+
+// GET /api/friends/blends
+func ListFriendBlendsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+	cur, err := config.DB.Collection("friend_blends").Find(ctx,
+		bson.M{"members": currentUser(r).SpotifyID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		return
+	}
+	defer cur.Close(ctx)
+	items := []friendBlend{}
+	for cur.Next(ctx) {
+		var fb friendBlend
+		if err := cur.Decode(&fb); err == nil {
+			items = append(items, fb)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
+
+// GET /api/friends/blends/:id
+func GetFriendBlendHandler(w http.ResponseWriter, r *http.Request) {
+	oid, err := primitive.ObjectIDFromHex(strings.TrimPrefix(r.URL.Path, "/api/friends/blends/"))
+	if err != nil {
+		http.Error(w, "blend not found", http.StatusNotFound)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+	var fb friendBlend
+	err = config.DB.Collection("friend_blends").FindOne(ctx, bson.M{"_id": oid, "members": currentUser(r).SpotifyID}).Decode(&fb)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		http.Error(w, "blend not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fb)
+}
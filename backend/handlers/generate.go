@@ -0,0 +1,570 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+
+	"github.com/Git-HimanshuRathi/artist-blend/backend/blend"
+	"github.com/Git-HimanshuRathi/artist-blend/backend/models"
+	"github.com/Git-HimanshuRathi/artist-blend/backend/spotify"
+)
+
+const (
+	defaultPlaylistLength = 20
+	minPlaylistLength     = 10
+	maxPlaylistLength     = 200
+	minPlaylistMinutes    = 10
+	maxPlaylistMinutes    = 600
+	maxSeedArtists        = 10
+	// averageTrackMs is used to turn a duration target into a track count
+	// when deciding how much catalogue to fetch.
+	averageTrackMs = 210000
+)
+
+// artistInput is one entry of the artists array: either a bare name or an
+// object with a Spotify ID and/or name and an optional weight. Artist objects
+// from the search endpoint can be passed straight through.
+type artistInput struct {
+	ID     string   `json:"id,omitempty" bson:"id,omitempty"`
+	Name   string   `json:"name" bson:"name"`
+	Weight *float64 `json:"weight,omitempty" bson:"weight,omitempty"`
+}
+
+func (a artistInput) label() string {
+	if a.Name != "" {
+		return a.Name
+	}
+	return a.ID
+}
+
+func (a *artistInput) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		*a = artistInput{Name: name}
+		return nil
+	}
+	type plain artistInput
+	return json.Unmarshal(b, (*plain)(a))
+}
+
+type generatePlaylistRequest struct {
+	Artists []artistInput `json:"artists" bson:"artists"`
+	// Length is the number of tracks wanted; DurationMinutes asks for a
+	// running time instead. At most one may be set.
+	Length          int `json:"length,omitempty" bson:"length,omitempty"`
+	DurationMinutes int `json:"durationMinutes,omitempty" bson:"duration_minutes,omitempty"`
+	// Discovery, when present, mixes in artists related to the seeds.
+	Discovery *discoveryOptions `json:"discovery,omitempty" bson:"discovery,omitempty"`
+	// FreshOnly leaves out tracks the logged-in user has saved, played
+	// recently or put on a playlist.
+	FreshOnly bool `json:"freshOnly,omitempty" bson:"fresh_only,omitempty"`
+	// Personalize uses the logged-in user's top artists as extra seeds or to
+	// break ties. Only available when ENABLE_PERSONALIZATION is set.
+	Personalize *personalOptions `json:"personalize,omitempty" bson:"personalize,omitempty"`
+	// Filters, when present, drop unwanted candidates before interleaving.
+	Filters *trackFilters `json:"filters,omitempty" bson:"filters,omitempty"`
+	// Order rearranges the finished playlist using audio features, e.g.
+	// "smooth", "build-up" or "harmonic". Empty keeps the artist rotation.
+	Order string `json:"order,omitempty" bson:"order,omitempty"`
+	// BPMTolerance is how far apart neighbouring tempos may be in harmonic
+	// order; 0 means blend.DefaultBPMTolerance.
+	BPMTolerance float64 `json:"bpmTolerance,omitempty" bson:"bpm_tolerance,omitempty"`
+	// Seed shuffles the blend: the artists' pools, the rotation and which
+	// discovered artists are picked. Sending back the seed of an earlier
+	// response (with the same request) reproduces it as long as Spotify's
+	// data hasn't changed. Without a seed the blend keeps Spotify's
+	// top-track order and rotates the artists in ID order.
+	Seed *int64 `json:"seed,omitempty" bson:"seed,omitempty"`
+	// Shuffle asks for a shuffled blend under a random seed, which the
+	// response reports. It is implied by Seed.
+	Shuffle bool `json:"shuffle,omitempty" bson:"shuffle,omitempty"`
+
+	// refreshing is the playlist being refreshed, whose own tracks
+	// FreshOnly mustn't count as known.
+	refreshing string
+}
+
+// simplifiedTrack carries key and BPM (Camelot notation) only when the blend
+// was reordered and audio features were fetched.
+type simplifiedTrack struct {
+	ID         string           `json:"id"`
+	Name       string           `json:"name"`
+	Artist     string           `json:"artist"`
+	Album      string           `json:"album"`
+	Duration   string           `json:"duration"`
+	Key        string           `json:"key,omitempty"`
+	BPM        float64          `json:"bpm,omitempty"`
+	Transition *trackTransition `json:"transition,omitempty"`
+}
+
+// trackTransition describes the mix from the previous track into this one.
+type trackTransition struct {
+	Key        string  `json:"key"`
+	BPMDelta   float64 `json:"bpmDelta"`
+	Compatible bool    `json:"compatible"`
+}
+
+// artistShare reports how much of the playlist a seed artist asked for and
+// how much it actually got.
+type artistShare struct {
+	Artist         string  `json:"artist"`
+	ArtistID       string  `json:"artistId"`
+	RequestedShare float64 `json:"requestedShare"`
+	Tracks         int     `json:"tracks"`
+	Share          float64 `json:"share"`
+}
+
+type generatePlaylistResponse struct {
+	Tracks          []simplifiedTrack  `json:"tracks"`
+	Resolved        []artistResolution `json:"resolved"`
+	Unresolved      []string           `json:"unresolved"`
+	Shares          []artistShare      `json:"shares"`
+	Length          int                `json:"length,omitempty"`
+	DurationMinutes int                `json:"durationMinutes,omitempty"`
+	TotalDuration   string             `json:"totalDuration"`
+	RelatedTracks   int                `json:"relatedTracks"`
+	Discovery       []discoveredArtist `json:"discovery,omitempty"`
+	Order           string             `json:"order"`
+	// Filtered counts the candidate tracks each filter removed.
+	Filtered map[string]int `json:"filtered,omitempty"`
+	// Seed and Request are what it takes to regenerate this blend. Seed is
+	// only set for shuffled blends.
+	Seed      *int64                   `json:"seed,omitempty"`
+	Request   *generatePlaylistRequest `json:"request"`
+	Reached   bool                     `json:"reached"`
+	Shortfall string                   `json:"shortfall,omitempty"`
+}
+
+// requestError is a problem with the request itself rather than upstream.
+// status defaults to 400.
+type requestError struct {
+	status int
+	msg    string
+}
+
+func (e *requestError) Error() string { return e.msg }
+
+func badRequest(format string, args ...any) error {
+	return &requestError{msg: fmt.Sprintf(format, args...)}
+}
+
+// playlistTarget says when a blend is long enough.
+type playlistTarget struct {
+	tracks     int
+	durationMs int
+}
+
+func (t playlistTarget) reached(tracks, durationMs int) bool {
+	if t.durationMs > 0 {
+		return durationMs >= t.durationMs
+	}
+	return tracks >= t.tracks
+}
+
+// estimatedTracks is roughly how many tracks the target will take.
+func (t playlistTarget) estimatedTracks() int {
+	if t.durationMs > 0 {
+		return (t.durationMs + averageTrackMs - 1) / averageTrackMs
+	}
+	return t.tracks
+}
+
+func (req *generatePlaylistRequest) target() (playlistTarget, error) {
+	switch {
+	case req.Length != 0 && req.DurationMinutes != 0:
+		return playlistTarget{}, badRequest("set either length or durationMinutes, not both")
+	case req.DurationMinutes != 0:
+		if req.DurationMinutes < minPlaylistMinutes || req.DurationMinutes > maxPlaylistMinutes {
+			return playlistTarget{}, badRequest("durationMinutes must be between %d and %d", minPlaylistMinutes, maxPlaylistMinutes)
+		}
+		return playlistTarget{durationMs: req.DurationMinutes * 60000}, nil
+	case req.Length != 0:
+		if req.Length < minPlaylistLength || req.Length > maxPlaylistLength {
+			return playlistTarget{}, badRequest("length must be between %d and %d", minPlaylistLength, maxPlaylistLength)
+		}
+		return playlistTarget{tracks: req.Length}, nil
+	}
+	return playlistTarget{tracks: defaultPlaylistLength}, nil
+}
+
+// seedWeights validates the optional per-artist weights. Weights are relative
+// (50/30/20 and 0.5/0.3/0.2 mean the same); with none given every artist
+// weighs 1.
+func seedWeights(inputs []artistInput) ([]float64, error) {
+	weights := make([]float64, len(inputs))
+	given := 0
+	for i, in := range inputs {
+		weights[i] = 1
+		if in.Weight == nil {
+			continue
+		}
+		w := *in.Weight
+		if math.IsNaN(w) || math.IsInf(w, 0) || w <= 0 {
+			return nil, badRequest("weight for %q must be a positive number", in.label())
+		}
+		weights[i] = w
+		given++
+	}
+	if given > 0 && given < len(inputs) {
+		return nil, badRequest("weights must be given for all artists or none")
+	}
+	return weights, nil
+}
+
+func formatDuration(ms int) string {
+	return fmt.Sprintf("%d:%02d", ms/60000, (ms%60000)/1000)
+}
+
+func toSimplifiedTrack(t spotify.Track) simplifiedTrack {
+	primaryArtist := ""
+	if len(t.Artists) > 0 {
+		primaryArtist = t.Artists[0].Name
+	}
+	return simplifiedTrack{
+		ID:       t.ID,
+		Name:     t.Name,
+		Artist:   primaryArtist,
+		Album:    t.Album.Name,
+		Duration: formatDuration(t.DurationMs),
+	}
+}
+
+// newBlendSeed picks a random seed, kept within what a JavaScript number
+// holds exactly so it survives the round trip through the frontend.
+func newBlendSeed() int64 {
+	return rand.Int64N(1 << 53)
+}
+
+// newBlendRand returns the random source all choices of a blend draw from.
+func newBlendRand(seed int64) *rand.Rand {
+	return rand.New(rand.NewPCG(uint64(seed), 0))
+}
+
+// generateBlend runs the whole blend for req: resolve seeds, gather
+// candidate tracks and interleave them up to the requested length. user is
+// the logged-in user, if any; only personal modes need one.
+func generateBlend(ctx context.Context, user *models.User, req *generatePlaylistRequest) (*generatePlaylistResponse, error) {
+	if len(req.Artists) == 0 {
+		return nil, badRequest("artists array is required")
+	}
+	target, err := req.target()
+	if err != nil {
+		return nil, err
+	}
+	weights, err := seedWeights(req.Artists)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateOrder(req.Order, req.BPMTolerance); err != nil {
+		return nil, err
+	}
+	if req.Filters != nil {
+		if err := req.Filters.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if req.FreshOnly && user == nil {
+		return nil, &requestError{status: http.StatusUnauthorized, msg: "log in to leave out tracks you already know"}
+	}
+	if req.Personalize != nil {
+		if !personalizationEnabled() {
+			return nil, badRequest("personalised blends are not enabled")
+		}
+		if err := req.Personalize.normalize(); err != nil {
+			return nil, err
+		}
+		if user == nil {
+			return nil, &requestError{status: http.StatusUnauthorized, msg: "log in to personalise the blend"}
+		}
+	}
+	if req.Shuffle && req.Seed == nil {
+		seed := newBlendSeed()
+		req.Seed = &seed
+	}
+	// Without a seed rng stays nil and nothing is shuffled
+	var rng *rand.Rand
+	if req.Seed != nil {
+		rng = newBlendRand(*req.Seed)
+	}
+	// Share of the playlist that goes to the seeds themselves
+	seedShare := 1.0
+	if req.Discovery != nil {
+		if err := req.Discovery.normalize(); err != nil {
+			return nil, err
+		}
+		seedShare = 1 - req.Discovery.Ratio
+	}
+
+	token, err := getAppAccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var library *userLibrary
+	if req.FreshOnly {
+		library, err = userLibraries.Get(ctx, user)
+		if spotify.IsStatus(err, http.StatusForbidden) {
+			return nil, &requestError{status: http.StatusForbidden, msg: "log in again to grant access to your library"}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if req.refreshing != "" {
+			library = library.without(req.refreshing)
+		}
+	}
+	filter := newTrackFilter(req.Filters, library)
+
+	resolution, err := resolveSeeds(ctx, token, req.Artists, weights, maxSeedArtists)
+	if err != nil {
+		return nil, err
+	}
+	seeds := resolution.Seeds
+	if len(seeds) == 0 {
+		return nil, badRequest("could not resolve any artist seeds")
+	}
+
+	// ranking is the taste that breaks ties between candidates, if any
+	var ranking *userTaste
+	if req.Personalize != nil {
+		taste, err := loadTaste(ctx, user, req.Personalize)
+		if spotify.IsStatus(err, http.StatusForbidden) {
+			return nil, &requestError{status: http.StatusForbidden, msg: "log in again to grant access to your top artists"}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if req.Personalize.Mode == personalTiebreak {
+			ranking = taste
+		} else {
+			mean := 0.0
+			for _, s := range seeds {
+				mean += s.Weight
+			}
+			mean /= float64(len(seeds))
+			n := min(req.Personalize.Artists, maxSeedArtists-len(seeds))
+			for _, s := range taste.extraSeeds(seeds, n, req.Personalize.Weight*mean) {
+				seeds = append(seeds, s)
+				resolution.Resolved = append(resolution.Resolved, artistResolution{ID: s.ID, Name: s.Name, MatchedBy: "top-artists", Used: true})
+			}
+		}
+	}
+
+	seedIDs := make([]string, len(seeds))
+	totalWeight := 0.0
+	for i, seed := range seeds {
+		seedIDs[i] = seed.ID
+		totalWeight += seed.Weight
+	}
+	pools, err := fetchTopTracks(ctx, token, seedIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i, pool := range pools {
+		if rng != nil {
+			rng.Shuffle(len(pool), func(a, b int) { pool[a], pool[b] = pool[b], pool[a] })
+		}
+		pools[i] = filter.apply(pool)
+	}
+
+	// Top tracks only go about ten deep; dig into albums for any artist whose
+	// share of the target needs more (plus a little slack for duplicates)
+	needs := make([]int, len(seeds))
+	for i, seed := range seeds {
+		needs[i] = int(math.Ceil(float64(target.estimatedTracks())*seedShare*seed.Weight/totalWeight)) + 2
+	}
+	if err := deepenPools(ctx, token, seedIDs, pools, needs, rng, filter); err != nil {
+		return nil, err
+	}
+	for _, pool := range pools {
+		ranking.rankPool(pool)
+	}
+
+	// Discovered artists are found up front so that their tracks take part
+	// in picking the preferred release of each recording
+	var discovered []discoveredArtist
+	var candidates []blend.Candidate
+	var discoveryPools [][]spotify.Track
+	if req.Discovery != nil {
+		discovered, candidates, discoveryPools, err = discoverArtists(ctx, token, seeds, req.Discovery, rng, ranking)
+		if err != nil {
+			return nil, err
+		}
+		for i := range discoveryPools {
+			discoveryPools[i] = filter.apply(discoveryPools[i])
+			ranking.rankPool(discoveryPools[i])
+		}
+	}
+	dedupe := newTrackDeduper()
+	dedupe.prefer(pools...)
+	dedupe.prefer(discoveryPools...)
+
+	// The rotation runs in artist ID order, so it doesn't depend on the
+	// order the artists were given in; a seed then shuffles it
+	order := make([]int, len(seeds))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return seeds[order[a]].ID < seeds[order[b]].ID })
+	if rng != nil {
+		rng.Shuffle(len(order), func(a, b int) { order[a], order[b] = order[b], order[a] })
+	}
+
+	buckets := make([]blend.Bucket[spotify.Track], len(order))
+	bucketOf := make([]int, len(seeds))
+	for bi, si := range order {
+		bucketOf[si] = bi
+		buckets[bi].Weight = seeds[si].Weight
+	}
+	for i := range seeds {
+		b := &buckets[bucketOf[i]]
+		b.Items = dedupe.add(b.Items, pools[i])
+	}
+
+	// Discovered artists share the discovery ratio in proportion to how well
+	// they connect the seeds
+	if req.Discovery != nil {
+		scoreTotal := 0.0
+		for _, c := range candidates {
+			scoreTotal += c.Score()
+		}
+		discoveryWeight := totalWeight * req.Discovery.Ratio / seedShare
+		for i, c := range candidates {
+			buckets = append(buckets, blend.Bucket[spotify.Track]{
+				Weight: discoveryWeight * c.Score() / scoreTotal,
+				Items:  dedupe.add(nil, discoveryPools[i]),
+			})
+		}
+	}
+
+	var out []spotify.Track
+	totalMs := 0
+	it := blend.NewInterleaver(buckets)
+	for !target.reached(len(out), totalMs) {
+		t, _, ok := it.Next()
+		if !ok {
+			break
+		}
+		out = append(out, t)
+		totalMs += t.DurationMs
+	}
+	counts := it.Counts()
+
+	// Still short: fill up with top tracks from related artists
+	related := 0
+	if !target.reached(len(out), totalMs) {
+		relatedPools, err := fetchRelatedPools(ctx, token, seeds)
+		if err != nil {
+			return nil, err
+		}
+		var filler []blend.Bucket[spotify.Track]
+		for _, pool := range relatedPools {
+			filler = append(filler, blend.Bucket[spotify.Track]{Weight: 1, Items: dedupe.add(nil, filter.apply(pool))})
+		}
+		fit := blend.NewInterleaver(filler)
+		for !target.reached(len(out), totalMs) {
+			t, _, ok := fit.Next()
+			if !ok {
+				break
+			}
+			out = append(out, t)
+			totalMs += t.DurationMs
+			related++
+		}
+	}
+
+	orderedBy := blendOrder
+	var features map[string]spotify.AudioFeatures
+	if req.Order != "" && req.Order != blendOrder {
+		features, err = fetchAudioFeatures(ctx, token, out)
+		if err != nil {
+			return nil, err
+		}
+		out, orderedBy = orderTracks(req.Order, req.BPMTolerance, out, features)
+	}
+
+	resp := &generatePlaylistResponse{
+		Tracks:          make([]simplifiedTrack, len(out)),
+		Resolved:        resolution.Resolved,
+		Unresolved:      resolution.Unresolved,
+		Shares:          make([]artistShare, len(seeds)),
+		Length:          req.Length,
+		DurationMinutes: req.DurationMinutes,
+		TotalDuration:   formatDuration(totalMs),
+		RelatedTracks:   related,
+		Discovery:       discovered,
+		Order:           orderedBy,
+		Filtered:        filter.counts(),
+		Seed:            req.Seed,
+		Request:         req,
+		Reached:         target.reached(len(out), totalMs),
+	}
+	if resp.Length == 0 && resp.DurationMinutes == 0 {
+		resp.Length = defaultPlaylistLength
+	}
+	for i, t := range out {
+		resp.Tracks[i] = toSimplifiedTrack(t)
+	}
+	annotateTracks(resp.Tracks, out, features, req.BPMTolerance)
+	for bi, si := range order {
+		resp.Shares[si] = artistShare{
+			Artist:         seeds[si].Name,
+			ArtistID:       seeds[si].ID,
+			RequestedShare: seedShare * seeds[si].Weight / totalWeight,
+			Tracks:         counts[bi],
+		}
+		if len(out) > 0 {
+			resp.Shares[si].Share = float64(counts[bi]) / float64(len(out))
+		}
+	}
+	for i := range discovered {
+		discovered[i].Tracks = counts[len(order)+i]
+	}
+	if !resp.Reached {
+		if target.durationMs > 0 {
+			resp.Shortfall = fmt.Sprintf("only %s of music found for a %d minute target", resp.TotalDuration, req.DurationMinutes)
+		} else {
+			resp.Shortfall = fmt.Sprintf("only %d of %d tracks found", len(out), target.tracks)
+		}
+	}
+	return resp, nil
+}
+
+// writeBlendError maps a generateBlend error onto an HTTP response.
+func writeBlendError(w http.ResponseWriter, err error) {
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		status := reqErr.status
+		if status == 0 {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, reqErr.msg, status)
+		return
+	}
+	writeSpotifyError(w, err, "failed to generate playlist")
+}
+
+// GeneratePlaylistHandler
+func GeneratePlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	var req generatePlaylistRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Outstanding Spotify calls are cancelled if the client disconnects
+	resp, err := generateBlend(r.Context(), currentUser(r), &req)
+	if err != nil {
+		writeBlendError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Git-HimanshuRathi/artist-blend/backend/models"
+	"github.com/Git-HimanshuRathi/artist-blend/backend/spotify"
+)
+
+const (
+	// libraryCacheTTL is how long a user's loaded library is reused.
+	libraryCacheTTL = 15 * time.Minute
+	// The caps below keep loading a large library to a few dozen calls.
+	maxSavedTracks      = 2000
+	maxLibraryPlaylists = 50
+	maxPlaylistTracks   = 500
+)
+
+// userLibrary is what fresh-only mode filters against: every track the user
+// has saved, played recently or put on one of their playlists, held as
+// dedupe keys so other releases of the same recordings are caught too.
+type userLibrary struct {
+	// keys counts the places each key was seen; a playlist counts once.
+	keys map[string]int
+	// playlists holds the keys on each playlist, so one can be left out.
+	playlists map[string]map[string]struct{}
+	// except is a playlist whose tracks don't count as known, see without.
+	except    string
+	fetchedAt time.Time
+}
+
+// addTrack records t. When t is on a playlist, in collects that playlist's
+// keys.
+func (l *userLibrary) addTrack(t *spotify.Track, in map[string]struct{}) {
+	if t == nil || t.ID == "" {
+		return
+	}
+	for _, k := range dedupeKeys(*t) {
+		if in != nil {
+			if _, dup := in[k]; dup {
+				continue
+			}
+			in[k] = struct{}{}
+		}
+		l.keys[k]++
+	}
+}
+
+// has reports whether the user already knows t.
+func (l *userLibrary) has(t spotify.Track) bool {
+	for _, k := range dedupeKeys(t) {
+		n := l.keys[k]
+		if _, ok := l.playlists[l.except][k]; ok {
+			n--
+		}
+		if n > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// without returns a view of l that doesn't count the tracks on playlistID,
+// unless they were also saved, played or put on another playlist. A
+// refreshed playlist would otherwise rule out its own tracks.
+func (l *userLibrary) without(playlistID string) *userLibrary {
+	view := *l
+	view.except = playlistID
+	return &view
+}
+
+// libraryCache keeps each user's library for libraryCacheTTL. Loads are
+// serialised per user so concurrent blends share one load.
+type libraryCache struct {
+	mu      sync.Mutex
+	locks   keyedMutex
+	entries map[string]*userLibrary
+}
+
+var userLibraries = &libraryCache{entries: make(map[string]*userLibrary)}
+
+// Get returns user's library, loading it from Spotify when it isn't cached
+// or the cached copy is stale.
+func (c *libraryCache) Get(ctx context.Context, user *models.User) (*userLibrary, error) {
+	defer c.locks.Lock(user.SpotifyID)()
+
+	c.mu.Lock()
+	lib := c.entries[user.SpotifyID]
+	c.mu.Unlock()
+	if lib != nil && time.Since(lib.fetchedAt) < libraryCacheTTL {
+		return lib, nil
+	}
+
+	err := withUserToken(ctx, user, func(token string) error {
+		loaded, err := loadLibrary(ctx, token)
+		lib = loaded
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, e := range c.entries {
+		if time.Since(e.fetchedAt) >= libraryCacheTTL {
+			delete(c.entries, id)
+		}
+	}
+	c.entries[user.SpotifyID] = lib
+	return lib, nil
+}
+
+// loadLibrary pulls the user's saved tracks, recent plays and playlists.
+func loadLibrary(ctx context.Context, token string) (*userLibrary, error) {
+	lib := &userLibrary{
+		keys:      make(map[string]int),
+		playlists: make(map[string]map[string]struct{}),
+		fetchedAt: time.Now(),
+	}
+
+	// Saved tracks: the first page tells how many more to fetch
+	first, err := spotifyAPI().SavedTracks(ctx, token, 50, 0)
+	if err != nil {
+		return nil, err
+	}
+	var offsets []int
+	for off := 50; off < min(first.Total, maxSavedTracks); off += 50 {
+		offsets = append(offsets, off)
+	}
+	saved := make([][]spotify.SavedTrack, len(offsets))
+	err = fanOut(ctx, len(offsets), spotifyConcurrency, func(ctx context.Context, i int) error {
+		page, err := spotifyAPI().SavedTracks(ctx, token, 50, offsets[i])
+		if err != nil {
+			return err
+		}
+		saved[i] = page.Items
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range append([][]spotify.SavedTrack{first.Items}, saved...) {
+		for i := range s {
+			lib.addTrack(&s[i].Track, nil)
+		}
+	}
+
+	recent, err := spotifyAPI().RecentlyPlayed(ctx, token, 50)
+	if err != nil {
+		return nil, err
+	}
+	for i := range recent {
+		lib.addTrack(&recent[i].Track, nil)
+	}
+
+	var playlists []string
+	for offset := 0; offset < maxLibraryPlaylists; offset += 50 {
+		page, err := spotifyAPI().UserPlaylists(ctx, token, 50, offset)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range page.Items {
+			playlists = append(playlists, p.ID)
+		}
+		if page.Next == "" {
+			break
+		}
+	}
+	if len(playlists) > maxLibraryPlaylists {
+		playlists = playlists[:maxLibraryPlaylists]
+	}
+	items := make([][]spotify.PlaylistItem, len(playlists))
+	err = fanOut(ctx, len(playlists), spotifyConcurrency, func(ctx context.Context, i int) error {
+		for offset := 0; offset < maxPlaylistTracks; offset += 100 {
+			page, err := spotifyAPI().PlaylistTracks(ctx, token, playlists[i], 100, offset)
+			if err != nil {
+				// A playlist that went away shouldn't sink the rest
+				if abortsBlend(err) || spotify.IsStatus(err, http.StatusUnauthorized) {
+					return err
+				}
+				return nil
+			}
+			items[i] = append(items[i], page.Items...)
+			if page.Next == "" {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, list := range items {
+		in := make(map[string]struct{})
+		lib.playlists[playlists[i]] = in
+		for _, it := range list {
+			lib.addTrack(it.Track, in)
+		}
+	}
+	return lib, nil
+}
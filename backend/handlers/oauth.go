@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	oauthCookieName = "ab_oauth"
+	oauthStateTTL   = 10 * time.Minute
+)
+
+var errBadOAuthState = errors.New("invalid or expired OAuth state")
+
+// oauthFlow is what LoginHandler remembers about an authorization request so
+// CallbackHandler can verify it came back from the same browser.
+type oauthFlow struct {
+	Nonce        string
+	CodeVerifier string
+	ReturnTo     string
+}
+
+// pkceEnabled reports whether the authorize request should carry a PKCE
+// code_challenge. Off unless SPOTIFY_USE_PKCE is set.
+func pkceEnabled() bool {
+	v := strings.ToLower(os.Getenv("SPOTIFY_USE_PKCE"))
+	return v == "1" || v == "true" || v == "yes"
+}
+
+// sanitizeReturnTo only lets through local paths on the frontend, so the
+// callback can't be turned into an open redirect.
+func sanitizeReturnTo(p string) string {
+	if p == "" || !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.Contains(p, "\\") {
+		return "/"
+	}
+	u, err := url.Parse(p)
+	if err != nil || u.Scheme != "" || u.Host != "" {
+		return "/"
+	}
+	return u.RequestURI()
+}
+
+// withQueryParam appends key=value to the query of a local path.
+func withQueryParam(p, key, value string) string {
+	u, err := url.Parse(p)
+	if err != nil {
+		return p
+	}
+	q := u.Query()
+	q.Set(key, value)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// newOAuthFlow creates a fresh nonce (and code verifier when PKCE is on).
+func newOAuthFlow(returnTo string) (*oauthFlow, error) {
+	nonce, err := newSessionToken()
+	if err != nil {
+		return nil, err
+	}
+	flow := &oauthFlow{Nonce: nonce, ReturnTo: sanitizeReturnTo(returnTo)}
+	if pkceEnabled() {
+		verifier, err := newSessionToken()
+		if err != nil {
+			return nil, err
+		}
+		flow.CodeVerifier = verifier
+	}
+	return flow, nil
+}
+
+// State is the value sent as the OAuth state parameter: the nonce, followed
+// by the return path so it survives the round trip through Spotify.
+func (f *oauthFlow) State() string {
+	return f.Nonce + "." + base64.RawURLEncoding.EncodeToString([]byte(f.ReturnTo))
+}
+
+// setOAuthCookie binds the flow to the browser. The cookie holds the nonce
+// and the PKCE verifier, which never leave our domain.
+func setOAuthCookie(w http.ResponseWriter, f *oauthFlow) {
+	secure, sameSite := getCookiePolicy()
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthCookieName,
+		Value:    f.Nonce + "." + f.CodeVerifier,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: sameSite,
+		MaxAge:   int(oauthStateTTL.Seconds()),
+	})
+}
+
+func clearOAuthCookie(w http.ResponseWriter) {
+	secure, sameSite := getCookiePolicy()
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthCookieName,
+		Value:    "",
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: sameSite,
+		MaxAge:   -1,
+	})
+}
+
+// verifyOAuthState checks the state returned by Spotify against the cookie
+// set by LoginHandler and recovers the flow.
+func verifyOAuthState(r *http.Request) (*oauthFlow, error) {
+	c, err := r.Cookie(oauthCookieName)
+	if err != nil || c.Value == "" {
+		return nil, errBadOAuthState
+	}
+	cookieNonce, verifier, _ := strings.Cut(c.Value, ".")
+
+	stateNonce, encodedReturn, _ := strings.Cut(r.URL.Query().Get("state"), ".")
+	if cookieNonce == "" || subtle.ConstantTimeCompare([]byte(cookieNonce), []byte(stateNonce)) != 1 {
+		return nil, errBadOAuthState
+	}
+	returnTo, err := base64.RawURLEncoding.DecodeString(encodedReturn)
+	if err != nil {
+		return nil, errBadOAuthState
+	}
+	return &oauthFlow{
+		Nonce:        cookieNonce,
+		CodeVerifier: verifier,
+		ReturnTo:     sanitizeReturnTo(string(returnTo)),
+	}, nil
+}
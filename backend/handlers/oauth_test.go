@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestSanitizeReturnTo(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", "/"},
+		{"/", "/"},
+		{"/history", "/history"},
+		{"/blend/invite/abc?x=1#top", "/blend/invite/abc?x=1"},
+		{"//evil.com", "/"},
+		{"///evil.com", "/"},
+		{"/\\evil.com", "/"},
+		{"\\\\evil.com", "/"},
+		{"https://evil.com", "/"},
+		{"http:/evil.com", "/"},
+		{"javascript:alert(1)", "/"},
+		{"evil.com", "/"},
+		{"/\t/evil.com", "/"},
+		{"/\n/evil.com", "/"},
+		// Encoded slashes and backslashes stay escaped, so they remain part
+		// of a local path
+		{"%2F%2Fevil.com", "/"},
+		{"/%2F%2Fevil.com", "/%2F%2Fevil.com"},
+		{"/%5Cevil.com", "/%5Cevil.com"},
+		{"/%09/evil.com", "/%09/evil.com"},
+	}
+	for _, tt := range tests {
+		if got := sanitizeReturnTo(tt.in); got != tt.want {
+			t.Errorf("sanitizeReturnTo(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// callbackRequest is Spotify redirecting back with state, carrying the
+// browser's OAuth cookie unless cookie is empty.
+func callbackRequest(state, cookie string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/callback?code=c&state="+url.QueryEscape(state), nil)
+	if cookie != "" {
+		r.AddCookie(&http.Cookie{Name: oauthCookieName, Value: cookie})
+	}
+	return r
+}
+
+func TestVerifyOAuthState(t *testing.T) {
+	flow := &oauthFlow{Nonce: "nonce", CodeVerifier: "verifier", ReturnTo: "/history"}
+	cookie := flow.Nonce + "." + flow.CodeVerifier
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+	got, err := verifyOAuthState(callbackRequest(flow.State(), cookie))
+	if err != nil {
+		t.Fatalf("valid state rejected: %v", err)
+	}
+	if *got != *flow {
+		t.Errorf("got flow %+v, want %+v", *got, *flow)
+	}
+
+	rejected := []struct {
+		name, state, cookie string
+	}{
+		{"missing cookie", flow.State(), ""},
+		{"nonce mismatch", "other." + encode("/history"), cookie},
+		{"missing state", "", cookie},
+		{"empty cookie nonce", "." + encode("/history"), "." + flow.CodeVerifier},
+		{"tampered returnTo", "nonce.!!not-base64!!", cookie},
+		{"padded returnTo", "nonce." + base64.URLEncoding.EncodeToString([]byte("/a")), cookie},
+	}
+	for _, tt := range rejected {
+		if _, err := verifyOAuthState(callbackRequest(tt.state, tt.cookie)); !errors.Is(err, errBadOAuthState) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, errBadOAuthState)
+		}
+	}
+
+	// A returnTo swapped for another site still decodes, but only as far as
+	// the home page
+	got, err = verifyOAuthState(callbackRequest("nonce."+encode("//evil.com"), cookie))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ReturnTo != "/" {
+		t.Errorf("tampered returnTo = %q, want %q", got.ReturnTo, "/")
+	}
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"context"
+	"math"
+	"strings"
+
+	"github.com/Git-HimanshuRathi/artist-blend/backend/blend"
+	"github.com/Git-HimanshuRathi/artist-blend/backend/spotify"
+)
+
+// blendOrder keeps the interleaved artist rotation as the final order.
+const blendOrder = "blend"
+
+// maxBPMTolerance bounds the tempo window harmonic ordering accepts.
+const maxBPMTolerance = 30.0
+
+// validateOrder checks the requested ordering strategy. An empty name means
+// the blend order.
+func validateOrder(name string, bpmTolerance float64) error {
+	if math.IsNaN(bpmTolerance) || bpmTolerance < 0 || bpmTolerance > maxBPMTolerance {
+		return badRequest("bpmTolerance must be between 0 and %.0f", maxBPMTolerance)
+	}
+	if name == "" || name == blendOrder {
+		return nil
+	}
+	if _, ok := blend.LookupOrderer(name); !ok {
+		names := append([]string{blendOrder}, blend.OrdererNames()...)
+		return badRequest("order must be one of: %s", strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// fetchAudioFeatures loads audio features for the tracks, 100 per call, keyed
+// by track ID. Tracks Spotify has no analysis for are missing from the map.
+func fetchAudioFeatures(ctx context.Context, token string, tracks []spotify.Track) (map[string]spotify.AudioFeatures, error) {
+	var batches [][]string
+	for start := 0; start < len(tracks); start += 100 {
+		end := min(start+100, len(tracks))
+		ids := make([]string, 0, end-start)
+		for _, t := range tracks[start:end] {
+			ids = append(ids, t.ID)
+		}
+		batches = append(batches, ids)
+	}
+	results := make([][]spotify.AudioFeatures, len(batches))
+	err := fanOut(ctx, len(batches), spotifyConcurrency, func(ctx context.Context, i int) error {
+		features, err := spotifyAPI().AudioFeatures(ctx, token, batches[i])
+		if err != nil {
+			if abortsBlend(err) {
+				return err
+			}
+			return nil
+		}
+		results[i] = features
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]spotify.AudioFeatures)
+	for _, features := range results {
+		for _, f := range features {
+			out[f.ID] = f
+		}
+	}
+	return out, nil
+}
+
+// trackFeatures lines the audio features up with tracks. Tracks without
+// features are treated as average so they land somewhere unremarkable; known
+// is false when no track has any.
+func trackFeatures(tracks []spotify.Track, features map[string]spotify.AudioFeatures) (in []blend.Features, known bool) {
+	mean := blend.Features{Key: -1}
+	n := 0
+	for _, t := range tracks {
+		if f, ok := features[t.ID]; ok {
+			mean.Tempo += f.Tempo
+			mean.Energy += f.Energy
+			mean.Valence += f.Valence
+			n++
+		}
+	}
+	if n == 0 {
+		return nil, false
+	}
+	mean.Tempo /= float64(n)
+	mean.Energy /= float64(n)
+	mean.Valence /= float64(n)
+
+	in = make([]blend.Features, len(tracks))
+	for i, t := range tracks {
+		f, ok := features[t.ID]
+		if !ok {
+			in[i] = mean
+			continue
+		}
+		in[i] = blend.Features{Tempo: f.Tempo, Energy: f.Energy, Valence: f.Valence, Key: f.Key, Mode: f.Mode}
+	}
+	return in, true
+}
+
+// orderTracks rearranges tracks with the named orderer and reports the order
+// actually used: with no audio features at all the blend order is kept.
+func orderTracks(name string, bpmTolerance float64, tracks []spotify.Track, features map[string]spotify.AudioFeatures) ([]spotify.Track, string) {
+	orderer, ok := blend.LookupOrderer(name)
+	if !ok {
+		return tracks, blendOrder
+	}
+	if h, ok := orderer.(blend.Harmonic); ok && bpmTolerance > 0 {
+		h.BPMTolerance = bpmTolerance
+		orderer = h
+	}
+	in, known := trackFeatures(tracks, features)
+	if !known {
+		return tracks, blendOrder
+	}
+	ordered := make([]spotify.Track, 0, len(tracks))
+	for _, i := range orderer.Order(in) {
+		ordered = append(ordered, tracks[i])
+	}
+	return ordered, name
+}
+
+// annotateTracks adds key, tempo and how well each track mixes out of the one
+// before it. Tracks without audio features are left bare.
+func annotateTracks(out []simplifiedTrack, tracks []spotify.Track, features map[string]spotify.AudioFeatures, bpmTolerance float64) {
+	h := blend.Harmonic{BPMTolerance: bpmTolerance}
+	var prev *spotify.AudioFeatures
+	for i, t := range tracks {
+		f, ok := features[t.ID]
+		if !ok {
+			prev = nil
+			continue
+		}
+		if c, ok := blend.CamelotKey(f.Key, f.Mode); ok {
+			out[i].Key = c.String()
+		}
+		out[i].BPM = math.Round(f.Tempo*10) / 10
+		cur := blend.Features{Tempo: f.Tempo, Energy: f.Energy, Valence: f.Valence, Key: f.Key, Mode: f.Mode}
+		if prev != nil {
+			last := blend.Features{Tempo: prev.Tempo, Key: prev.Key, Mode: prev.Mode}
+			out[i].Transition = &trackTransition{
+				Key:        blend.KeyRelation(last, cur),
+				BPMDelta:   math.Round(blend.TempoGap(prev.Tempo, f.Tempo)*10) / 10,
+				Compatible: h.Mixes(last, cur),
+			}
+		}
+		prev = &f
+	}
+}
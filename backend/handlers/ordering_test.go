@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/Git-HimanshuRathi/artist-blend/backend/blend"
+	"github.com/Git-HimanshuRathi/artist-blend/backend/spotify"
+)
+
+func TestTrackFeaturesFillsGaps(t *testing.T) {
+	tracks := []spotify.Track{{ID: "a"}, {ID: "b"}, {ID: "c"}}
+	features := map[string]spotify.AudioFeatures{
+		"a": {Tempo: 100, Energy: 0.25, Valence: 0.5, Key: 5, Mode: 1},
+		"c": {Tempo: 140, Energy: 0.75, Valence: 1, Key: 7, Mode: 0},
+	}
+	in, known := trackFeatures(tracks, features)
+	if !known {
+		t.Fatal("known = false with features for two tracks")
+	}
+	// The missing track sits at the average, with no key
+	want := blend.Features{Tempo: 120, Energy: 0.5, Valence: 0.75, Key: -1}
+	if got := in[1]; got != want {
+		t.Errorf("missing track got %+v, want %+v", got, want)
+	}
+	if in[0].Key != 5 || in[2].Tempo != 140 {
+		t.Errorf("known tracks changed: %+v", in)
+	}
+
+	if _, known := trackFeatures(tracks, nil); known {
+		t.Error("known = true without any features")
+	}
+}
+
+func TestOrderTracksWithoutFeatures(t *testing.T) {
+	tracks := []spotify.Track{{ID: "a"}, {ID: "b"}, {ID: "c"}}
+	got, order := orderTracks("build-up", 0, tracks, nil)
+	if order != blendOrder || !slices.Equal(poolIDs(got), []string{"a", "b", "c"}) {
+		t.Errorf("got %v in order %q, want the blend order kept", poolIDs(got), order)
+	}
+}
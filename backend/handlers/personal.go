@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/Git-HimanshuRathi/artist-blend/backend/models"
+	"github.com/Git-HimanshuRathi/artist-blend/backend/spotify"
+)
+
+const (
+	personalSeeds    = "seeds"
+	personalTiebreak = "tiebreak"
+
+	defaultPersonalArtists = 3
+	maxPersonalArtists     = 10
+	defaultPersonalWeight  = 0.5
+	maxPersonalWeight      = 2
+)
+
+// personalizationEnabled reports whether personalised and friend blends are
+// switched on. They need the user-top-read scope, which login only asks for
+// then.
+func personalizationEnabled() bool {
+	v := strings.ToLower(os.Getenv("ENABLE_PERSONALIZATION"))
+	return v == "1" || v == "true" || v == "yes"
+}
+
+// personalOptions lets the logged-in user's listening shape the blend.
+type personalOptions struct {
+	// Mode "seeds" adds the user's top artists as extra seeds; "tiebreak"
+	// only uses them to rank candidate tracks and discovered artists.
+	Mode string `json:"mode" bson:"mode"`
+	// TimeRange is "short", "medium" (default), "long" or "all".
+	TimeRange string `json:"timeRange,omitempty" bson:"time_range,omitempty"`
+	// Artists is how many top artists become seeds in seeds mode.
+	Artists int `json:"artists,omitempty" bson:"artists,omitempty"`
+	// Weight of each extra seed relative to an average requested one.
+	Weight float64 `json:"weight,omitempty" bson:"weight,omitempty"`
+}
+
+func (o *personalOptions) normalize() error {
+	if o.TimeRange == "" {
+		o.TimeRange = "medium"
+	}
+	if o.Artists == 0 {
+		o.Artists = defaultPersonalArtists
+	}
+	if o.Weight == 0 {
+		o.Weight = defaultPersonalWeight
+	}
+	switch {
+	case o.Mode != personalSeeds && o.Mode != personalTiebreak:
+		return badRequest("personalize.mode must be %q or %q", personalSeeds, personalTiebreak)
+	case len(o.timeRanges()) == 0:
+		return badRequest("personalize.timeRange must be short, medium, long or all")
+	case o.Artists < 1 || o.Artists > maxPersonalArtists:
+		return badRequest("personalize.artists must be between 1 and %d", maxPersonalArtists)
+	case o.Weight <= 0 || o.Weight > maxPersonalWeight:
+		return badRequest("personalize.weight must be above 0 and at most %d", maxPersonalWeight)
+	}
+	return nil
+}
+
+func (o *personalOptions) timeRanges() []string {
+	switch o.TimeRange {
+	case "short":
+		return []string{spotify.ShortTerm}
+	case "medium":
+		return []string{spotify.MediumTerm}
+	case "long":
+		return []string{spotify.LongTerm}
+	case "all":
+		return []string{spotify.ShortTerm, spotify.MediumTerm, spotify.LongTerm}
+	}
+	return nil
+}
+
+// userTaste is what the user's top lists say about them. Affinities run
+// from 0 to 1, higher for artists and tracks nearer the top.
+type userTaste struct {
+	artists    map[string]float64
+	tracks     map[string]float64
+	topArtists []spotify.Artist
+}
+
+// loadTaste fetches the user's top artists and tracks over the requested
+// time ranges. An item's affinity is its best placing in any of them.
+func loadTaste(ctx context.Context, user *models.User, opts *personalOptions) (*userTaste, error) {
+	ranges := opts.timeRanges()
+	artists := make([][]spotify.Artist, len(ranges))
+	tracks := make([][]spotify.Track, len(ranges))
+	err := withUserToken(ctx, user, func(token string) error {
+		return fanOut(ctx, 2*len(ranges), spotifyConcurrency, func(ctx context.Context, i int) error {
+			r := i / 2
+			if i%2 == 0 {
+				page, err := spotifyAPI().TopArtists(ctx, token, ranges[r], 50)
+				if err != nil {
+					return err
+				}
+				artists[r] = page.Items
+				return nil
+			}
+			page, err := spotifyAPI().TopTracks(ctx, token, ranges[r], 50)
+			if err != nil {
+				return err
+			}
+			tracks[r] = page.Items
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	taste := &userTaste{artists: make(map[string]float64), tracks: make(map[string]float64)}
+	byID := make(map[string]spotify.Artist)
+	for _, list := range artists {
+		for rank, a := range list {
+			if a.ID == "" {
+				continue
+			}
+			byID[a.ID] = a
+			taste.artists[a.ID] = max(taste.artists[a.ID], 1-float64(rank)/float64(len(list)))
+		}
+	}
+	for _, list := range tracks {
+		for rank, t := range list {
+			if t.ID != "" {
+				taste.tracks[t.ID] = max(taste.tracks[t.ID], 1-float64(rank)/float64(len(list)))
+			}
+		}
+	}
+	for _, a := range byID {
+		taste.topArtists = append(taste.topArtists, a)
+	}
+	sort.Slice(taste.topArtists, func(i, j int) bool {
+		ai, aj := taste.artists[taste.topArtists[i].ID], taste.artists[taste.topArtists[j].ID]
+		if ai != aj {
+			return ai > aj
+		}
+		return taste.topArtists[i].ID < taste.topArtists[j].ID
+	})
+	return taste, nil
+}
+
+// artistAffinity is 0 for artists outside the user's top list and for a nil
+// taste, so callers needn't check.
+func (u *userTaste) artistAffinity(id string) float64 {
+	if u == nil {
+		return 0
+	}
+	return u.artists[id]
+}
+
+// trackAffinity favours the user's top tracks, then tracks by or featuring
+// their top artists.
+func (u *userTaste) trackAffinity(t spotify.Track) float64 {
+	if u == nil {
+		return 0
+	}
+	best := 0.0
+	for _, a := range t.Artists {
+		best = max(best, u.artists[a.ID])
+	}
+	return u.tracks[t.ID] + best/2
+}
+
+// rankPool lets the user's taste break ties in a candidate pool: within each
+// run of neighbouring tracks of equal popularity, such as catalogue tracks
+// Spotify gives none, the better liked go first. The pool's order otherwise
+// stands.
+func (u *userTaste) rankPool(pool []spotify.Track) {
+	if u == nil {
+		return
+	}
+	for start := 0; start < len(pool); {
+		end := start + 1
+		for end < len(pool) && pool[end].Popularity == pool[start].Popularity {
+			end++
+		}
+		run := pool[start:end]
+		sort.SliceStable(run, func(i, j int) bool {
+			return u.trackAffinity(run[i]) > u.trackAffinity(run[j])
+		})
+		start = end
+	}
+}
+
+// extraSeeds picks up to n of the user's top artists that aren't seeds yet.
+func (u *userTaste) extraSeeds(seeds []resolvedSeed, n int, weight float64) []resolvedSeed {
+	taken := make(map[string]bool)
+	for _, s := range seeds {
+		taken[s.ID] = true
+	}
+	var extra []resolvedSeed
+	for _, a := range u.topArtists {
+		if len(extra) >= n {
+			break
+		}
+		if taken[a.ID] {
+			continue
+		}
+		extra = append(extra, resolvedSeed{ID: a.ID, Name: a.Name, Weight: weight})
+	}
+	return extra
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/Git-HimanshuRathi/artist-blend/backend/spotify"
+)
+
+func poolIDs(pool []spotify.Track) []string {
+	ids := make([]string, len(pool))
+	for i, t := range pool {
+		ids[i] = t.ID
+	}
+	return ids
+}
+
+func TestRankPool(t *testing.T) {
+	track := func(id string, popularity int) spotify.Track {
+		return spotify.Track{ID: id, Popularity: popularity, Artists: []spotify.Artist{{ID: "artist-" + id}}}
+	}
+	// Top tracks in Spotify's order, then catalogue tracks without a
+	// popularity
+	base := []spotify.Track{track("a", 80), track("b", 70), track("c", 70), track("d", 60), track("e", 0), track("f", 0), track("g", 0)}
+
+	tests := []struct {
+		name  string
+		taste *userTaste
+		want  []string
+	}{
+		{"no taste", nil, []string{"a", "b", "c", "d", "e", "f", "g"}},
+		{"no affinities", &userTaste{}, []string{"a", "b", "c", "d", "e", "f", "g"}},
+		{
+			"equal affinities",
+			&userTaste{tracks: map[string]float64{"a": 0.5, "b": 0.5, "c": 0.5, "d": 0.5, "e": 0.5, "f": 0.5, "g": 0.5}},
+			[]string{"a", "b", "c", "d", "e", "f", "g"},
+		},
+		{
+			"taste breaks ties only",
+			&userTaste{tracks: map[string]float64{"d": 1, "c": 0.8, "g": 0.5}, artists: map[string]float64{"artist-f": 0.4}},
+			[]string{"a", "c", "b", "d", "g", "f", "e"},
+		},
+	}
+	for _, tt := range tests {
+		pool := slices.Clone(base)
+		tt.taste.rankPool(pool)
+		if got := poolIDs(pool); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -3,192 +3,233 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
-	"net/url"
-	"sort"
+	"slices"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/Git-HimanshuRathi/artist-blend/backend/config"
+	"github.com/Git-HimanshuRathi/artist-blend/backend/models"
+	"github.com/Git-HimanshuRathi/artist-blend/backend/spotify"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-type generatePlaylistRequest struct {
+const (
+	// playlistBatchSize is the most tracks Spotify adds in one call.
+	playlistBatchSize = 100
+
+	rollbackOnFailure = "rollback"
+	partialOnFailure  = "partial"
+
+	createMode  = "create"
+	replaceMode = "replace"
+	appendMode  = "append"
+
+	// Spotify's limits on playlist details, in characters
+	maxPlaylistNameLength        = 100
+	maxPlaylistDescriptionLength = 300
+
+	defaultPlaylistDescription = "Created with ArtistBlend"
+)
+
+type createPlaylistRequest struct {
+	TrackIDs []string `json:"trackIds"`
+	Name     string   `json:"name"`
+	// Description may use {artists} for the blended artists' names and
+	// {date} for today's date. Description, Public and Collaborative only
+	// apply when creating a playlist; a collaborative one must be private.
+	Description   string `json:"description"`
+	Public        bool   `json:"public"`
+	Collaborative bool   `json:"collaborative"`
+	// Artists names the blended artists for {artists}; without it the names
+	// in Request are used.
 	Artists []string `json:"artists"`
+	// Mode is "create" (default) for a new playlist, or "replace" or
+	// "append" to update the saved playlist PlaylistID instead.
+	Mode       string `json:"mode"`
+	PlaylistID string `json:"playlistId"`
+	// OnFailure is "rollback" (default) to remove a new playlist when
+	// adding tracks fails, or "partial" to keep what was added and report
+	// where to resume.
+	OnFailure string `json:"onFailure"`
+	// Resume continues a partial create: trackIds from Resume.From on are
+	// added to the playlist it left behind.
+	Resume *resumePlaylistRequest `json:"resume"`
+	// Request is the generate request behind the tracks, kept so the
+	// playlist can be re-blended later (see auto-refresh).
+	Request *generatePlaylistRequest `json:"request"`
 }
 
-type simplifiedTrack struct {
-	ID       string `json:"id"`
-	Name     string `json:"name"`
-	Artist   string `json:"artist"`
-	Album    string `json:"album"`
-	Duration string `json:"duration"`
+type resumePlaylistRequest struct {
+	PlaylistID string `json:"playlistId"`
+	From       int    `json:"from"`
 }
 
-type generatePlaylistResponse struct {
-	Tracks []simplifiedTrack `json:"tracks"`
+type createPlaylistResponse struct {
+	URL        string `json:"url"`
+	PlaylistID string `json:"playlistId"`
+	SnapshotID string `json:"snapshotId,omitempty"`
+	Added      int    `json:"added"`
+	Total      int    `json:"total"`
+	// Partial is set when not every track made it; send the same trackIds
+	// with resume {playlistId, from: resumeFrom} to finish. ResumeFrom is an
+	// index into trackIds, and is left out when the playlist can't be
+	// resumed.
+	Partial    bool   `json:"partial,omitempty"`
+	ResumeFrom *int   `json:"resumeFrom,omitempty"`
+	Error      string `json:"error,omitempty"`
+	// Cover is "pending" when a generated cover is being uploaded for a new
+	// playlist.
+	Cover string `json:"cover,omitempty"`
 }
 
-// GeneratePlaylistHandler
-func GeneratePlaylistHandler(w http.ResponseWriter, r *http.Request) {
-	var req generatePlaylistRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
-		return
-	}
-	if len(req.Artists) == 0 {
-		http.Error(w, "artists array is required", http.StatusBadRequest)
-		return
-	}
-
-	token, err := getAppAccessToken()
-	if err != nil {
-		http.Error(w, "failed to acquire app token", http.StatusInternalServerError)
-		return
-	}
+const coverPending = "pending"
+
+// playlistEntry is a playlist created through ArtistBlend, as stored in the
+// "playlists" collection.
+type playlistEntry struct {
+	ID            string            `bson:"_id,omitempty" json:"id"`
+	SpotifyID     string            `bson:"spotify_id" json:"spotifyId"`
+	Name          string            `bson:"name" json:"name"`
+	TrackIDs      []string          `bson:"track_ids" json:"trackIds"`
+	SpotifyPID    string            `bson:"spotify_playlist_id" json:"spotifyPlaylistId"`
+	SpotifyURL    string            `bson:"spotify_url" json:"spotifyUrl"`
+	Description   string            `bson:"description,omitempty" json:"description,omitempty"`
+	Public        bool              `bson:"public" json:"public"`
+	Collaborative bool              `bson:"collaborative" json:"collaborative"`
+	SnapshotID    string            `bson:"snapshot_id,omitempty" json:"snapshotId,omitempty"`
+	Partial       bool              `bson:"partial,omitempty" json:"partial,omitempty"`
+	CreatedAt     time.Time         `bson:"created_at" json:"createdAt"`
+	UpdatedAt     time.Time         `bson:"updated_at,omitempty" json:"updatedAt,omitempty"`
+	Tracks        []simplifiedTrack `bson:"tracks" json:"tracks"`
+	// Request is the blend behind the playlist, when the client sent it.
+	Request     *generatePlaylistRequest `bson:"request,omitempty" json:"request,omitempty"`
+	RefreshedAt *time.Time               `bson:"refreshed_at,omitempty" json:"refreshedAt,omitempty"`
+}
 
-	var seedIDs []string
-	for _, name := range req.Artists {
-		n := strings.TrimSpace(name)
-		if n == "" {
-			continue
-		}
-		if len(seedIDs) >= 5 {
-			break
-		}
-		searchURL := fmt.Sprintf("https://api.spotify.com/v1/search?type=artist&limit=1&q=%s", url.QueryEscape(n))
-		sreq, _ := http.NewRequest("GET", searchURL, nil)
-		sreq.Header.Set("Authorization", "Bearer "+token)
-		sresp, err := http.DefaultClient.Do(sreq)
+// addTracksInBatches adds uris to a playlist in order, 100 per call. It
+// returns how many went in and the snapshot ID after the last batch that
+// did; on error the rest are left out.
+func addTracksInBatches(ctx context.Context, user *models.User, playlistID string, uris []string) (int, string, error) {
+	added, snapshot := 0, ""
+	for added < len(uris) {
+		end := min(added+playlistBatchSize, len(uris))
+		err := withUserToken(ctx, user, func(token string) error {
+			snap, err := spotifyAPI().AddTracksToPlaylist(ctx, token, playlistID, uris[added:end])
+			if err == nil {
+				snapshot = snap
+			}
+			return err
+		})
 		if err != nil {
-			continue
+			return added, snapshot, err
 		}
-		func() {
-			defer sresp.Body.Close()
-			if sresp.StatusCode < 200 || sresp.StatusCode >= 300 {
-				return
-			}
-			var payload map[string]any
-			if err := json.NewDecoder(sresp.Body).Decode(&payload); err != nil {
-				return
-			}
-			artists, _ := payload["artists"].(map[string]any)
-			items, _ := artists["items"].([]any)
-			if len(items) == 0 {
-				return
-			}
-			first, _ := items[0].(map[string]any)
-			id, _ := first["id"].(string)
-			if id != "" {
-				seedIDs = append(seedIDs, id)
-			}
-		}()
-	}
-
-	if len(seedIDs) == 0 {
-		http.Error(w, "could not resolve any artist seeds", http.StatusBadRequest)
-		return
+		added = end
 	}
+	return added, snapshot, nil
+}
 
-	type artistTracks struct {
-		artistID string
-		tracks   []simplifiedTrack
-	}
-
-	combined := make([]artistTracks, 0, len(seedIDs))
-	seen := make(map[string]struct{})
-
-	for _, artistID := range seedIDs {
-		topURL := fmt.Sprintf("https://api.spotify.com/v1/artists/%s/top-tracks?market=US", url.PathEscape(artistID))
-		treq, _ := http.NewRequest("GET", topURL, nil)
-		treq.Header.Set("Authorization", "Bearer "+token)
-		tresp, err := http.DefaultClient.Do(treq)
-		if err != nil {
-			continue
+// describePlaylist fills in a description template. {artists} lists the
+// artists as "A, B & C".
+func describePlaylist(template string, artists []string, now time.Time) string {
+	names := make([]string, 0, len(artists))
+	for _, a := range artists {
+		if a = strings.TrimSpace(a); a != "" {
+			names = append(names, a)
 		}
-		func() {
-			defer tresp.Body.Close()
-			if tresp.StatusCode < 200 || tresp.StatusCode >= 300 {
-				return
-			}
-			var tp map[string]any
-			if err := json.NewDecoder(tresp.Body).Decode(&tp); err != nil {
-				return
-			}
-			titems, _ := tp["tracks"].([]any)
-			bucket := artistTracks{artistID: artistID}
-			for _, it := range titems {
-				t, _ := it.(map[string]any)
-				if t == nil {
-					continue
-				}
-				id, _ := t["id"].(string)
-				if id == "" {
-					continue
-				}
-				if _, ok := seen[id]; ok {
-					continue
-				}
-				name, _ := t["name"].(string)
-				durationMs, _ := t["duration_ms"].(float64)
-				albumObj, _ := t["album"].(map[string]any)
-				albumName, _ := albumObj["name"].(string)
-				artistsArr, _ := t["artists"].([]any)
-				primaryArtist := ""
-				if len(artistsArr) > 0 {
-					a0, _ := artistsArr[0].(map[string]any)
-					primaryArtist, _ = a0["name"].(string)
-				}
-				totalMs := int(durationMs)
-				mm := totalMs / 60000
-				ss := (totalMs % 60000) / 1000
-				duration := fmt.Sprintf("%d:%02d", mm, ss)
-				bucket.tracks = append(bucket.tracks, simplifiedTrack{
-					ID:       id,
-					Name:     name,
-					Artist:   primaryArtist,
-					Album:    albumName,
-					Duration: duration,
-				})
-				seen[id] = struct{}{}
-			}
-			combined = append(combined, bucket)
-		}()
 	}
+	list := strings.Join(names, ", ")
+	if n := len(names); n > 1 {
+		list = strings.Join(names[:n-1], ", ") + " & " + names[n-1]
+	}
+	return strings.NewReplacer("{artists}", list, "{date}", now.Format("January 2, 2006")).Replace(template)
+}
 
-	var out []simplifiedTrack
-	sort.SliceStable(combined, func(i, j int) bool { return combined[i].artistID < combined[j].artistID })
-	picked := 0
-	idx := 0
-	for picked < 20 {
-		advanced := false
-		for i := 0; i < len(combined) && picked < 20; i++ {
-			tracks := combined[i].tracks
-			if idx < len(tracks) {
-				out = append(out, tracks[idx])
-				picked++
-				advanced = true
-			}
+// playlistDetails validates the name and description a create request asks
+// for and returns them as sent to Spotify.
+func (req *createPlaylistRequest) playlistDetails(now time.Time) (spotify.PlaylistDetails, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = "ArtistBlend Playlist"
+	}
+	template := strings.TrimSpace(req.Description)
+	if template == "" {
+		template = defaultPlaylistDescription
+	}
+	artists := req.Artists
+	if len(artists) == 0 && req.Request != nil {
+		for _, a := range req.Request.Artists {
+			artists = append(artists, a.Name)
 		}
-		if !advanced {
-			break
-		}
-		idx++
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(generatePlaylistResponse{Tracks: out})
+	description := describePlaylist(template, artists, now)
+	switch {
+	case utf8.RuneCountInString(name) > maxPlaylistNameLength:
+		return spotify.PlaylistDetails{}, badRequest("name must be at most %d characters", maxPlaylistNameLength)
+	case strings.ContainsAny(description, "\r\n"):
+		return spotify.PlaylistDetails{}, badRequest("description must be a single line")
+	case utf8.RuneCountInString(description) > maxPlaylistDescriptionLength:
+		return spotify.PlaylistDetails{}, badRequest("description must be at most %d characters once filled in", maxPlaylistDescriptionLength)
+	case req.Collaborative && req.Public:
+		return spotify.PlaylistDetails{}, badRequest("a collaborative playlist can't be public")
+	}
+	return spotify.PlaylistDetails{
+		Name:          name,
+		Description:   description,
+		Public:        req.Public,
+		Collaborative: req.Collaborative,
+	}, nil
 }
 
-type createPlaylistRequest struct {
-	TrackIDs []string `json:"trackIds"`
-	Name     string   `json:"name"`
+// ownedPlaylist loads the playlist user saved as playlistID and checks with
+// Spotify that it still exists and that user still owns it.
+func ownedPlaylist(ctx context.Context, user *models.User, playlistID string) (*playlistEntry, error) {
+	var doc playlistEntry
+	err := config.DB.Collection("playlists").FindOne(ctx, bson.M{"spotify_playlist_id": playlistID, "spotify_id": user.SpotifyID}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, &requestError{status: http.StatusNotFound, msg: "playlist not found"}
+	}
+	if err != nil {
+		return nil, err
+	}
+	var playlist *spotify.Playlist
+	err = withUserToken(ctx, user, func(token string) error {
+		var err error
+		playlist, err = spotifyAPI().Playlist(ctx, token, playlistID)
+		return err
+	})
+	if spotify.IsStatus(err, http.StatusNotFound) {
+		return nil, &requestError{status: http.StatusNotFound, msg: "playlist no longer exists on Spotify"}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if playlist.Owner.ID != user.SpotifyID {
+		return nil, &requestError{status: http.StatusForbidden, msg: "you no longer own this playlist"}
+	}
+	return &doc, nil
 }
 
-type createPlaylistResponse struct {
-	URL string `json:"url"`
+// trackURIs turns track IDs into URIs, skipping blank IDs. pos[i] is the
+// index in ids that uris[i] came from.
+func trackURIs(ids []string) (uris []string, pos []int) {
+	uris = make([]string, 0, len(ids))
+	pos = make([]int, 0, len(ids))
+	for i, id := range ids {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		uris = append(uris, "spotify:track:"+id)
+		pos = append(pos, i)
+	}
+	return uris, pos
 }
 
 func CreatePlaylistHandler(w http.ResponseWriter, r *http.Request) {
@@ -201,164 +242,277 @@ func CreatePlaylistHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "trackIds is required", http.StatusBadRequest)
 		return
 	}
-
-	// Fetch the most recently updated user
-	collection := config.DB.Collection("users")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	var userDoc bson.M
-	findOpts := options.FindOne().SetSort(bson.D{{Key: "updated_at", Value: -1}})
-	if err := collection.FindOne(ctx, bson.M{}, findOpts).Decode(&userDoc); err != nil {
-		http.Error(w, "no authenticated user found", http.StatusUnauthorized)
-		return
-	}
-
-	accessToken, _ := userDoc["access_token"].(string)
-	spotifyUserID, _ := userDoc["spotify_id"].(string)
-	if accessToken == "" || spotifyUserID == "" {
-		http.Error(w, "invalid user credentials", http.StatusUnauthorized)
+	switch req.Mode {
+	case "":
+		req.Mode = createMode
+	case createMode:
+	case replaceMode, appendMode:
+		if req.PlaylistID == "" {
+			http.Error(w, "playlistId is required to "+req.Mode, http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "mode must be create, replace or append", http.StatusBadRequest)
 		return
 	}
-
-	playlistName := strings.TrimSpace(req.Name)
-	if playlistName == "" {
-		playlistName = "ArtistBlend Playlist"
-	}
-
-	body := map[string]any{
-		"name":        playlistName,
-		"description": "Created with ArtistBlend",
-		"public":      false,
-	}
-	bodyBytes, _ := json.Marshal(body)
-	createURL := fmt.Sprintf("https://api.spotify.com/v1/users/%s/playlists", url.PathEscape(spotifyUserID))
-	creq, _ := http.NewRequest("POST", createURL, strings.NewReader(string(bodyBytes)))
-	creq.Header.Set("Authorization", "Bearer "+accessToken)
-	creq.Header.Set("Content-Type", "application/json")
-	cresp, err := http.DefaultClient.Do(creq)
-	if err != nil {
-		http.Error(w, "failed to create playlist", http.StatusBadGateway)
+	if req.Resume != nil && req.Mode != createMode {
+		http.Error(w, "resume can't be combined with mode "+req.Mode, http.StatusBadRequest)
 		return
 	}
-	defer cresp.Body.Close()
-	if cresp.StatusCode < 200 || cresp.StatusCode >= 300 {
-		http.Error(w, "Spotify playlist create error", http.StatusBadGateway)
+	switch req.OnFailure {
+	case "":
+		req.OnFailure = rollbackOnFailure
+	case rollbackOnFailure, partialOnFailure:
+	default:
+		http.Error(w, "onFailure must be rollback or partial", http.StatusBadRequest)
 		return
 	}
-	var playlist map[string]any
-	if err := json.NewDecoder(cresp.Body).Decode(&playlist); err != nil {
-		http.Error(w, "failed to parse playlist response", http.StatusInternalServerError)
+
+	// Act for the user behind the session, never some other account
+	user := currentUser(r)
+	spotifyUserID := user.SpotifyID
+	if user.AccessToken == "" && user.RefreshToken == "" {
+		http.Error(w, "invalid user credentials", http.StatusUnauthorized)
 		return
 	}
-	playlistID, _ := playlist["id"].(string)
-	external, _ := playlist["external_urls"].(map[string]any)
-	externalURL, _ := external["spotify"].(string)
-	if playlistID == "" {
-		http.Error(w, "missing playlist id", http.StatusBadGateway)
-		return
+	var details spotify.PlaylistDetails
+	if req.Mode == createMode && req.Resume == nil {
+		var err error
+		if details, err = req.playlistDetails(time.Now()); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 	}
+	ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
+	defer cancel()
 
-	// Add tracks
-	if len(req.TrackIDs) > 0 {
-		uris := make([]string, 0, len(req.TrackIDs))
-		for _, id := range req.TrackIDs {
-			id = strings.TrimSpace(id)
-			if id == "" {
-				continue
-			}
-			uris = append(uris, "spotify:track:"+id)
+	uris, pos := trackURIs(req.TrackIDs)
+	coll := config.DB.Collection("playlists")
+
+	var playlistID, externalURL, playlistName string
+	var existing *playlistEntry
+	start := 0
+	if req.Resume != nil || req.Mode != createMode {
+		// Only touch playlists this user created through us and still owns
+		target := req.PlaylistID
+		if req.Resume != nil {
+			target = req.Resume.PlaylistID
 		}
-		addBody := map[string]any{"uris": uris}
-		addBytes, _ := json.Marshal(addBody)
-		addURL := fmt.Sprintf("https://api.spotify.com/v1/playlists/%s/tracks", url.PathEscape(playlistID))
-		areq, _ := http.NewRequest("POST", addURL, strings.NewReader(string(addBytes)))
-		areq.Header.Set("Authorization", "Bearer "+accessToken)
-		areq.Header.Set("Content-Type", "application/json")
-		aresp, err := http.DefaultClient.Do(areq)
+		doc, err := ownedPlaylist(ctx, user, target)
+		var reqErr *requestError
+		if errors.As(err, &reqErr) {
+			http.Error(w, reqErr.msg, reqErr.status)
+			return
+		}
+		if err != nil {
+			writeSpotifyError(w, err, "failed to look up playlist")
+			return
+		}
+		if req.Resume != nil && (req.Resume.From < 0 || req.Resume.From > len(req.TrackIDs)) {
+			http.Error(w, "resume.from is out of range", http.StatusBadRequest)
+			return
+		}
+		existing = doc
+		playlistID, externalURL, playlistName = doc.SpotifyPID, doc.SpotifyURL, doc.Name
+		if req.Resume != nil {
+			// Resume.From counts trackIds, blanks included
+			start, _ = slices.BinarySearch(pos, req.Resume.From)
+		}
+	} else {
+		playlistName = details.Name
+		var playlist *spotify.Playlist
+		err := withUserToken(ctx, user, func(token string) error {
+			var err error
+			playlist, err = spotifyAPI().CreatePlaylist(ctx, token, spotifyUserID, details)
+			return err
+		})
 		if err != nil {
-			http.Error(w, "failed to add tracks", http.StatusBadGateway)
+			writeSpotifyError(w, err, "Spotify playlist create error")
 			return
 		}
-		defer aresp.Body.Close()
-		if aresp.StatusCode < 200 || aresp.StatusCode >= 300 {
-			http.Error(w, "Spotify add tracks error", http.StatusBadGateway)
+		playlistID = playlist.ID
+		externalURL = playlist.ExternalURLs.Spotify
+		if playlistID == "" {
+			http.Error(w, "missing playlist id", http.StatusBadGateway)
 			return
 		}
 	}
 
+	snapshot := ""
+	if req.Mode == replaceMode {
+		// Replacing takes one call of up to 100 tracks; the rest are added
+		first := uris[:min(playlistBatchSize, len(uris))]
+		err := withUserToken(ctx, user, func(token string) error {
+			var err error
+			snapshot, err = spotifyAPI().ReplacePlaylistTracks(ctx, token, playlistID, first)
+			return err
+		})
+		if err != nil {
+			writeSpotifyError(w, err, "Spotify replace tracks error")
+			return
+		}
+		start = len(first)
+	}
+	added, snap, addErr := addTracksInBatches(ctx, user, playlistID, uris[start:])
+	if snap != "" {
+		snapshot = snap
+	}
+	resp := createPlaylistResponse{
+		URL:        externalURL,
+		PlaylistID: playlistID,
+		SnapshotID: snapshot,
+		Added:      start + added,
+		Total:      len(uris),
+	}
+	if addErr != nil && existing == nil && req.OnFailure == rollbackOnFailure {
+		// Don't leave a half-filled playlist behind. The request context may
+		// be what failed, so the rollback gets its own.
+		rbCtx, rbCancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer rbCancel()
+		rbErr := withUserToken(rbCtx, user, func(token string) error {
+			return spotifyAPI().UnfollowPlaylist(rbCtx, token, playlistID)
+		})
+		if rbErr == nil {
+			writeSpotifyError(w, addErr, "Spotify add tracks error")
+			return
+		}
+		// Couldn't roll back: fall through and report what is there
+	}
+	if addErr != nil {
+		resp.Partial = true
+		from := len(req.TrackIDs)
+		if resp.Added < len(pos) {
+			from = pos[resp.Added]
+		}
+		resp.ResumeFrom = &from
+		resp.Error = addErr.Error()
+	}
+	if existing == nil {
+		var artists []artistInput
+		if req.Request != nil {
+			artists = req.Request.Artists
+		} else {
+			for _, name := range req.Artists {
+				artists = append(artists, artistInput{Name: name})
+			}
+		}
+		// The playlist is fine without a cover, so it is made once the
+		// response is out and failures are only logged
+		resp.Cover = coverPending
+		defer func() {
+			go func() {
+				if err := uploadPlaylistCover(context.Background(), user, playlistID, playlistName, artists); err != nil {
+					log.Printf("cover for playlist %s: %v", playlistID, err)
+				}
+			}()
+		}()
+	}
+
 	// Persist playlist to MongoDB
-	type playlistEntry struct {
-		ID         string            `bson:"_id,omitempty" json:"id"`
-		SpotifyID  string            `bson:"spotify_id" json:"spotifyId"`
-		Name       string            `bson:"name" json:"name"`
-		TrackIDs   []string          `bson:"track_ids" json:"trackIds"`
-		SpotifyPID string            `bson:"spotify_playlist_id" json:"spotifyPlaylistId"`
-		SpotifyURL string            `bson:"spotify_url" json:"spotifyUrl"`
-		CreatedAt  time.Time         `bson:"created_at" json:"createdAt"`
-		Tracks     []simplifiedTrack `bson:"tracks" json:"tracks"`
-	}
-
-	doc := playlistEntry{
-		SpotifyID:  spotifyUserID,
-		Name:       playlistName,
-		TrackIDs:   req.TrackIDs,
-		SpotifyPID: playlistID,
-		SpotifyURL: externalURL,
-		CreatedAt:  time.Now(),
-		// Optionally store simplified tracks if caller provided them elsewhere; here we leave empty
-		Tracks: []simplifiedTrack{},
+	now := time.Now()
+	ctxSave, cancelSave := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelSave()
+	var saveErr error
+	if existing != nil {
+		set := bson.M{"updated_at": now, "partial": resp.Partial}
+		switch req.Mode {
+		case replaceMode:
+			set["track_ids"] = req.TrackIDs
+		case appendMode:
+			// Only record what made it onto the playlist
+			added := req.TrackIDs
+			if resp.Partial {
+				added = added[:*resp.ResumeFrom]
+			}
+			set["track_ids"] = append(existing.TrackIDs, added...)
+		}
+		if req.Mode == replaceMode && req.Request != nil {
+			set["request"] = req.Request
+		}
+		if snapshot != "" {
+			set["snapshot_id"] = snapshot
+		}
+		_, saveErr = coll.UpdateOne(ctxSave, bson.M{"spotify_playlist_id": playlistID, "spotify_id": spotifyUserID}, bson.M{"$set": set})
+	} else {
+		doc := playlistEntry{
+			SpotifyID:     spotifyUserID,
+			Name:          playlistName,
+			TrackIDs:      req.TrackIDs,
+			SpotifyPID:    playlistID,
+			SpotifyURL:    externalURL,
+			Description:   details.Description,
+			Public:        details.Public,
+			Collaborative: details.Collaborative,
+			SnapshotID:    snapshot,
+			Partial:       resp.Partial,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+			Request:       req.Request,
+			// Optionally store simplified tracks if caller provided them elsewhere; here we leave empty
+			Tracks: []simplifiedTrack{},
+		}
+		_, saveErr = coll.InsertOne(ctxSave, doc)
 	}
-	coll := config.DB.Collection("playlists")
-	ctxInsert, cancelInsert := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancelInsert()
-	if _, err := coll.InsertOne(ctxInsert, doc); err != nil {
+	if saveErr != nil && !resp.Partial {
 		// Not fatal for user, but log and continue returning URL
 		http.Error(w, "playlist created on Spotify but failed to persist", http.StatusAccepted)
 		return
 	}
+	if saveErr != nil && existing == nil {
+		// Resuming looks the playlist up in MongoDB, so without a record
+		// there is nothing to resume
+		log.Printf("saving partial playlist %s: %v", playlistID, saveErr)
+		resp.ResumeFrom = nil
+		resp.Error += "; playlist failed to persist, so it can't be resumed"
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(createPlaylistResponse{URL: externalURL})
+	if resp.Partial {
+		w.WriteHeader(http.StatusMultiStatus)
+	}
+	json.NewEncoder(w).Encode(resp)
 }
 
+// historyEntry is a saved blend. Seed and Request, when the client sends
+// them back from the generate response, let the blend be regenerated as is.
 type historyEntry struct {
-	ID        string            `bson:"_id,omitempty" json:"id"`
-	SpotifyID string            `bson:"spotify_id" json:"spotifyId"`
-	Title     string            `bson:"title" json:"title"`
-	Artists   []string          `bson:"artists" json:"artists"`
-	Tracks    []simplifiedTrack `bson:"tracks" json:"tracks"`
-	CreatedAt time.Time         `bson:"created_at" json:"createdAt"`
-}
-
-func getUserIDFromCookie(r *http.Request) (string, bool) {
-	c, err := r.Cookie("ab_sid")
-	if err != nil || c.Value == "" {
-		return "", false
-	}
-	return c.Value, true
+	ID        string                   `bson:"_id,omitempty" json:"id"`
+	SpotifyID string                   `bson:"spotify_id" json:"spotifyId"`
+	Title     string                   `bson:"title" json:"title"`
+	Artists   []string                 `bson:"artists" json:"artists"`
+	Tracks    []simplifiedTrack        `bson:"tracks" json:"tracks"`
+	Seed      *int64                   `bson:"seed,omitempty" json:"seed,omitempty"`
+	Request   *generatePlaylistRequest `bson:"request,omitempty" json:"request,omitempty"`
+	CreatedAt time.Time                `bson:"created_at" json:"createdAt"`
 }
 
 func SaveHistoryHandler(w http.ResponseWriter, r *http.Request) {
-	userID, ok := getUserIDFromCookie(r)
-	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
-		return
-	}
+	userID := currentUser(r).SpotifyID
 	var body struct {
-		Title   string            `json:"title"`
-		Artists []string          `json:"artists"`
-		Tracks  []simplifiedTrack `json:"tracks"`
+		Title   string                   `json:"title"`
+		Artists []string                 `json:"artists"`
+		Tracks  []simplifiedTrack        `json:"tracks"`
+		Seed    *int64                   `json:"seed"`
+		Request *generatePlaylistRequest `json:"request"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		http.Error(w, "invalid body", http.StatusBadRequest)
 		return
 	}
+	if body.Request != nil && body.Seed != nil {
+		body.Request.Seed = body.Seed
+	}
 	entry := historyEntry{
 		SpotifyID: userID,
 		Title:     strings.TrimSpace(body.Title),
 		Artists:   body.Artists,
 		Tracks:    body.Tracks,
+		Seed:      body.Seed,
+		Request:   body.Request,
 		CreatedAt: time.Now(),
 	}
 	coll := config.DB.Collection("history")
@@ -375,11 +529,7 @@ func SaveHistoryHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func ListHistoryHandler(w http.ResponseWriter, r *http.Request) {
-	userID, ok := getUserIDFromCookie(r)
-	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
-		return
-	}
+	userID := currentUser(r).SpotifyID
 	coll := config.DB.Collection("history")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -402,11 +552,7 @@ func ListHistoryHandler(w http.ResponseWriter, r *http.Request) {
 
 // DELETE /api/history/:id
 func DeleteHistoryHandler(w http.ResponseWriter, r *http.Request) {
-	userID, ok := getUserIDFromCookie(r)
-	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
-		return
-	}
+	userID := currentUser(r).SpotifyID
 	id := strings.TrimPrefix(r.URL.Path, "/api/history/")
 	if id == "" {
 		http.Error(w, "missing id", http.StatusBadRequest)
@@ -425,11 +571,7 @@ func DeleteHistoryHandler(w http.ResponseWriter, r *http.Request) {
 
 // ListUserPlaylistsHandler handles GET /api/playlist/user
 func ListUserPlaylistsHandler(w http.ResponseWriter, r *http.Request) {
-	userID, ok := getUserIDFromCookie(r)
-	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
-		return
-	}
+	userID := currentUser(r).SpotifyID
 
 	coll := config.DB.Collection("playlists")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
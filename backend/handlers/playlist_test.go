@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Git-HimanshuRathi/artist-blend/backend/config"
+	"github.com/Git-HimanshuRathi/artist-blend/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// spotifyCall is a request the fake Spotify received.
+type spotifyCall struct {
+	method, path, auth string
+	body               map[string]any
+}
+
+// fakeSpotify records every call and answers the playlist endpoints the way
+// Spotify does, naming each playlist "pl-" and its owner. Adding the track
+// "unavailable" fails.
+type fakeSpotify struct {
+	mu    sync.Mutex
+	calls []spotifyCall
+	// tokenDelay holds up token responses.
+	tokenDelay time.Duration
+}
+
+func (f *fakeSpotify) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	call := spotifyCall{method: r.Method, path: r.URL.Path, auth: r.Header.Get("Authorization")}
+	if r.Header.Get("Content-Type") == "application/json" {
+		json.NewDecoder(r.Body).Decode(&call.body)
+	}
+	f.mu.Lock()
+	f.calls = append(f.calls, call)
+	tokenDelay := f.tokenDelay
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.URL.Path == "/api/token":
+		time.Sleep(tokenDelay)
+		json.NewEncoder(w).Encode(map[string]any{"access_token": "app-token", "expires_in": 3600})
+	case len(parts) == 4 && parts[1] == "users" && parts[3] == "playlists":
+		id := "pl-" + parts[2]
+		json.NewEncoder(w).Encode(map[string]any{
+			"id":            id,
+			"external_urls": map[string]string{"spotify": "https://open.spotify.com/playlist/" + id},
+		})
+	case len(parts) == 4 && parts[1] == "playlists" && parts[3] == "tracks":
+		if uris, _ := call.body["uris"].([]any); slices.Contains(uris, any("spotify:track:unavailable")) {
+			http.Error(w, `{"error":{"status":403,"message":"unavailable"}}`, http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"snapshot_id": "snap-" + parts[2]})
+	case len(parts) == 3 && parts[1] == "playlists" && r.Method == http.MethodGet:
+		owner := strings.TrimPrefix(parts[2], "pl-")
+		json.NewEncoder(w).Encode(map[string]any{"id": parts[2], "owner": map[string]string{"id": owner}})
+	case len(parts) == 4 && parts[1] == "playlists" && parts[3] == "images":
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// reset forgets the calls so far and any delay.
+func (f *fakeSpotify) reset() {
+	f.mu.Lock()
+	f.calls = nil
+	f.tokenDelay = 0
+	f.mu.Unlock()
+}
+
+func (f *fakeSpotify) callsMatching(method, suffix string) []spotifyCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []spotifyCall
+	for _, c := range f.calls {
+		if c.method == method && strings.HasSuffix(c.path, suffix) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// waitForCalls waits for n matching calls, for work that carries on after
+// the handler returns.
+func (f *fakeSpotify) waitForCalls(method, suffix string, n int) []spotifyCall {
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		calls := f.callsMatching(method, suffix)
+		if len(calls) >= n || time.Now().After(deadline) {
+			return calls
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// useFakeSpotify points the shared client at fake. spotifyAPI is built once
+// per process, so every test using it must share the same fake.
+var useFakeSpotify = sync.OnceValue(func() *fakeSpotify {
+	fake := &fakeSpotify{}
+	srv := httptest.NewServer(fake)
+	os.Setenv("SPOTIFY_API_BASE_URL", srv.URL+"/v1")
+	os.Setenv("SPOTIFY_ACCOUNTS_BASE_URL", srv.URL)
+	os.Setenv("SPOTIFY_REQUESTS_PER_SECOND", "1000")
+	os.Setenv("SPOTIFY_CLIENT_ID", "client")
+	os.Setenv("SPOTIFY_CLIENT_SECRET", "secret")
+	return fake
+})
+
+// useUnreachableDB stands in for MongoDB, which tests don't have: every
+// operation fails fast, so handlers take their failed-save paths.
+func useUnreachableDB(t *testing.T) {
+	client, err := mongo.Connect(context.Background(), options.Client().
+		ApplyURI("mongodb://127.0.0.1:1").
+		SetServerSelectionTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.DB = client.Database("artistblend_test")
+	t.Cleanup(func() { client.Disconnect(context.Background()) })
+}
+
+// withSession attaches user to r the way RequireUser does for a session.
+func withSession(r *http.Request, user *models.User) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), userContextKey{}, user))
+}
+
+func TestCreatePlaylistConcurrentUsers(t *testing.T) {
+	fake := useFakeSpotify()
+	fake.reset()
+	useUnreachableDB(t)
+
+	users := []*models.User{
+		{SpotifyID: "alice", AccessToken: "token-alice", TokenExpiresAt: time.Now().Add(time.Hour)},
+		{SpotifyID: "bob", AccessToken: "token-bob", TokenExpiresAt: time.Now().Add(time.Hour)},
+	}
+	const rounds = 5
+
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, u := range users {
+		for i := 0; i < rounds; i++ {
+			wg.Add(1)
+			go func(u *models.User) {
+				defer wg.Done()
+				body := `{"name":"Blend","trackIds":["track-` + u.SpotifyID + `"]}`
+				r := withSession(httptest.NewRequest(http.MethodPost, "/api/playlist/create", strings.NewReader(body)), u)
+				w := httptest.NewRecorder()
+				<-start
+				CreatePlaylistHandler(w, r)
+				// Saving fails without MongoDB, which the handler reports as 202
+				if w.Code != http.StatusOK && w.Code != http.StatusAccepted {
+					t.Errorf("%s: status %d: %s", u.SpotifyID, w.Code, w.Body)
+				}
+			}(u)
+		}
+	}
+	close(start)
+	wg.Wait()
+
+	creates := fake.callsMatching(http.MethodPost, "/playlists")
+	adds := fake.callsMatching(http.MethodPost, "/tracks")
+	// Covers are uploaded after the response
+	covers := fake.waitForCalls(http.MethodPut, "/images", len(users)*rounds)
+	if n := len(users) * rounds; len(creates) != n || len(adds) != n || len(covers) != n {
+		t.Fatalf("got %d creates, %d adds and %d covers, want %d of each", len(creates), len(adds), len(covers), n)
+	}
+	for _, c := range creates {
+		owner := strings.Split(c.path, "/")[3]
+		if c.auth != "Bearer token-"+owner {
+			t.Errorf("playlist for %s created with %q", owner, c.auth)
+		}
+	}
+	for _, c := range append(adds, covers...) {
+		owner := strings.TrimPrefix(strings.Split(c.path, "/")[3], "pl-")
+		if c.auth != "Bearer token-"+owner {
+			t.Errorf("%s %s sent with %q", c.method, c.path, c.auth)
+		}
+	}
+	for _, c := range adds {
+		owner := strings.TrimPrefix(strings.Split(c.path, "/")[3], "pl-")
+		uris, _ := c.body["uris"].([]any)
+		if len(uris) != 1 || uris[0] != "spotify:track:track-"+owner {
+			t.Errorf("playlist of %s got tracks %v", owner, uris)
+		}
+	}
+}
+
+func TestTrackURIsPositions(t *testing.T) {
+	uris, pos := trackURIs([]string{"", "a", " ", "b ", "c"})
+	if want := []string{"spotify:track:a", "spotify:track:b", "spotify:track:c"}; !slices.Equal(uris, want) {
+		t.Errorf("uris = %v, want %v", uris, want)
+	}
+	if want := []int{1, 3, 4}; !slices.Equal(pos, want) {
+		t.Errorf("pos = %v, want %v", pos, want)
+	}
+}
+
+func TestCreatePlaylistPartialUnsaved(t *testing.T) {
+	fake := useFakeSpotify()
+	fake.reset()
+	useUnreachableDB(t)
+
+	user := &models.User{SpotifyID: "carol", AccessToken: "token-carol", TokenExpiresAt: time.Now().Add(time.Hour)}
+	body := `{"name":"Blend","trackIds":["","unavailable","a"],"onFailure":"partial"}`
+	r := withSession(httptest.NewRequest(http.MethodPost, "/api/playlist/create", strings.NewReader(body)), user)
+	w := httptest.NewRecorder()
+	CreatePlaylistHandler(w, r)
+
+	// Without a saved record the playlist can't be resumed, so no offset
+	// may be offered
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status %d, want %d: %s", w.Code, http.StatusInternalServerError, w.Body)
+	}
+	var resp map[string]any
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp["partial"] != true || resp["playlistId"] != "pl-carol" {
+		t.Errorf("response %v, want a partial pl-carol", resp)
+	}
+	if from, ok := resp["resumeFrom"]; ok {
+		t.Errorf("resumeFrom = %v, want it left out", from)
+	}
+	if resp["cover"] != coverPending {
+		t.Errorf("cover = %v, want %q", resp["cover"], coverPending)
+	}
+	// Let the cover finish so it doesn't land in another test
+	if covers := fake.waitForCalls(http.MethodPut, "/images", 1); len(covers) != 1 {
+		t.Errorf("got %d covers, want 1", len(covers))
+	}
+}
+
+func TestAppendPlaylistPartialSavesAdded(t *testing.T) {
+	fake := useFakeSpotify()
+	fake.reset()
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("partial append", func(mt *mtest.T) {
+		mockDB(mt)
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "artistblend_test.playlists", mtest.FirstBatch, bson.D{
+				{Key: "spotify_id", Value: "dave"},
+				{Key: "spotify_playlist_id", Value: "pl-dave"},
+				{Key: "track_ids", Value: bson.A{"old"}},
+			}),
+			mtest.CreateSuccessResponse(),
+		)
+
+		user := &models.User{SpotifyID: "dave", AccessToken: "token-dave", TokenExpiresAt: time.Now().Add(time.Hour)}
+		// A full batch goes in, then the second one fails
+		ids := make([]string, playlistBatchSize+2)
+		for i := range playlistBatchSize {
+			ids[i] = "t" + strconv.Itoa(i)
+		}
+		ids[playlistBatchSize], ids[playlistBatchSize+1] = "unavailable", "last"
+		body, _ := json.Marshal(map[string]any{"mode": "append", "playlistId": "pl-dave", "trackIds": ids})
+		r := withSession(httptest.NewRequest(http.MethodPost, "/api/playlist/create", bytes.NewReader(body)), user)
+		w := httptest.NewRecorder()
+		CreatePlaylistHandler(w, r)
+
+		if w.Code != http.StatusMultiStatus {
+			mt.Fatalf("status %d, want %d: %s", w.Code, http.StatusMultiStatus, w.Body)
+		}
+		mt.GetStartedEvent() // the playlist lookup
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		values, err := update.Lookup("u", "$set", "track_ids").Array().Values()
+		if err != nil {
+			mt.Fatal(err)
+		}
+		var stored []string
+		for _, v := range values {
+			stored = append(stored, v.StringValue())
+		}
+		if want := append([]string{"old"}, ids[:playlistBatchSize]...); !slices.Equal(stored, want) {
+			mt.Errorf("stored %d track IDs ending %v, want %d ending %v", len(stored), stored[len(stored)-1:], len(want), want[len(want)-1:])
+		}
+	})
+}
@@ -0,0 +1,527 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Git-HimanshuRathi/artist-blend/backend/config"
+	"github.com/Git-HimanshuRathi/artist-blend/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	refreshDaily  = "daily"
+	refreshWeekly = "weekly"
+	refreshOff    = "off"
+
+	// refreshTick is how often each replica looks for due jobs.
+	refreshTick = time.Minute
+	// refreshLease is how long a replica holds a job it claimed. A run is
+	// cut off at half of it, so a lease only lapses if its replica died.
+	refreshLease = 10 * time.Minute
+	// maxRefreshFailures in a row pause a job until the user re-enables it.
+	maxRefreshFailures = 5
+	refreshRunsTTL     = 90 * 24 * time.Hour
+	refreshRunsShown   = 20
+
+	runUpdated   = "updated"
+	runUnchanged = "unchanged"
+	runFailed    = "failed"
+	runDisabled  = "disabled"
+)
+
+// refreshJob re-blends a saved playlist on a schedule. It is keyed by the
+// Spotify playlist ID, so a playlist has at most one.
+type refreshJob struct {
+	PlaylistID string     `bson:"_id" json:"playlistId"`
+	SpotifyID  string     `bson:"spotify_id" json:"spotifyId"`
+	Interval   string     `bson:"interval" json:"interval"`
+	NextRunAt  time.Time  `bson:"next_run_at" json:"nextRunAt"`
+	LastRunAt  *time.Time `bson:"last_run_at,omitempty" json:"lastRunAt,omitempty"`
+	LastStatus string     `bson:"last_status,omitempty" json:"lastStatus,omitempty"`
+	Failures   int        `bson:"failures" json:"failures"`
+	// Disabled jobs need the user's attention, e.g. the playlist is gone or
+	// the user has to log in again. Re-enabling clears it.
+	Disabled bool `bson:"disabled" json:"disabled"`
+	// The replica running the job holds it until LeaseUntil.
+	LeaseOwner string    `bson:"lease_owner,omitempty" json:"-"`
+	LeaseUntil time.Time `bson:"lease_until" json:"-"`
+	CreatedAt  time.Time `bson:"created_at" json:"createdAt"`
+	UpdatedAt  time.Time `bson:"updated_at" json:"updatedAt"`
+}
+
+// refreshRun is one entry of a playlist's refresh log.
+type refreshRun struct {
+	ID         string    `bson:"_id,omitempty" json:"id"`
+	PlaylistID string    `bson:"playlist_id" json:"playlistId"`
+	SpotifyID  string    `bson:"spotify_id" json:"spotifyId"`
+	StartedAt  time.Time `bson:"started_at" json:"startedAt"`
+	FinishedAt time.Time `bson:"finished_at" json:"finishedAt"`
+	Status     string    `bson:"status" json:"status"`
+	Seed       int64     `bson:"seed,omitempty" json:"seed,omitempty"`
+	Added      int       `bson:"added" json:"added"`
+	Removed    int       `bson:"removed" json:"removed"`
+	Kept       int       `bson:"kept" json:"kept"`
+	Error      string    `bson:"error,omitempty" json:"error,omitempty"`
+}
+
+func refreshInterval(name string) (time.Duration, bool) {
+	switch name {
+	case refreshDaily:
+		return 24 * time.Hour, true
+	case refreshWeekly:
+		return 7 * 24 * time.Hour, true
+	}
+	return 0, false
+}
+
+// schedulerID names this replica in the leases it takes.
+var schedulerID = func() string {
+	host, _ := os.Hostname()
+	b := make([]byte, 6)
+	rand.Read(b)
+	return host + "-" + hex.EncodeToString(b)
+}()
+
+// EnsureRefreshIndexes indexes jobs by due time and expires old run logs.
+func EnsureRefreshIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := config.DB.Collection("refresh_jobs").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "disabled", Value: 1}, {Key: "next_run_at", Value: 1}}},
+		{Keys: bson.D{{Key: "spotify_id", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = config.DB.Collection("refresh_runs").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "playlist_id", Value: 1}, {Key: "started_at", Value: -1}}},
+		{Keys: bson.D{{Key: "started_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(int32(refreshRunsTTL.Seconds()))},
+	})
+	return err
+}
+
+// StartRefreshScheduler runs due refresh jobs in the background until ctx is
+// done. Every replica runs one; a job is only run by the replica holding its
+// lease, so none runs twice.
+func StartRefreshScheduler(ctx context.Context) {
+	go func() {
+		t := time.NewTicker(refreshTick)
+		defer t.Stop()
+		for {
+			runDueRefreshes(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+		}
+	}()
+}
+
+func runDueRefreshes(ctx context.Context) {
+	for ctx.Err() == nil {
+		job, err := claimRefreshJob(ctx)
+		if err != nil {
+			if !errors.Is(err, mongo.ErrNoDocuments) {
+				log.Printf("refresh: failed to claim job: %v", err)
+			}
+			return
+		}
+		runRefreshJob(ctx, job)
+	}
+}
+
+// claimRefreshJob leases the most overdue job that no live replica holds.
+func claimRefreshJob(ctx context.Context) (*refreshJob, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	now := time.Now()
+	var job refreshJob
+	err := config.DB.Collection("refresh_jobs").FindOneAndUpdate(ctx, bson.M{
+		"disabled":    false,
+		"next_run_at": bson.M{"$lte": now},
+		"lease_until": bson.M{"$lt": now},
+	}, bson.M{"$set": bson.M{"lease_owner": schedulerID, "lease_until": now.Add(refreshLease)}},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "next_run_at", Value: 1}}).
+			SetReturnDocument(options.After)).Decode(&job)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// disablesRefresh reports whether err means a refresh can never succeed:
+// the user or the playlist is gone, or there is no refresh token to act with.
+func disablesRefresh(err error) bool {
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		return reqErr.status == http.StatusGone || reqErr.status == http.StatusNotFound
+	}
+	return errors.Is(err, errNoRefreshToken)
+}
+
+// runRefreshJob refreshes job's playlist, logs the run and schedules the
+// next one. Failures are retried sooner, backing off, until there have been
+// maxRefreshFailures in a row; a job that can never succeed is disabled
+// straight away.
+func runRefreshJob(ctx context.Context, job *refreshJob) {
+	runCtx, cancel := context.WithTimeout(ctx, refreshLease/2)
+	defer cancel()
+	run := refreshRun{PlaylistID: job.PlaylistID, SpotifyID: job.SpotifyID, StartedAt: time.Now()}
+	err := refreshPlaylist(runCtx, job, &run)
+	run.FinishedAt = time.Now()
+
+	interval, _ := refreshInterval(job.Interval)
+	set := bson.M{"last_run_at": run.StartedAt, "updated_at": run.FinishedAt, "lease_until": time.Time{}}
+	switch {
+	case disablesRefresh(err):
+		run.Status, run.Error = runDisabled, err.Error()
+		set["disabled"] = true
+	case err != nil:
+		run.Status, run.Error = runFailed, err.Error()
+		failures := job.Failures + 1
+		set["failures"] = failures
+		set["disabled"] = failures >= maxRefreshFailures
+		set["next_run_at"] = run.FinishedAt.Add(min(time.Hour<<(failures-1), interval))
+	default:
+		set["failures"] = 0
+		set["next_run_at"] = run.FinishedAt.Add(interval)
+	}
+	set["last_status"] = run.Status
+
+	// Don't let the update outlive a shutdown half done
+	saveCtx, saveCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer saveCancel()
+	// A replica whose lease lapsed mustn't overwrite the new holder's state
+	_, err = config.DB.Collection("refresh_jobs").UpdateOne(saveCtx,
+		bson.M{"_id": job.PlaylistID, "lease_owner": schedulerID},
+		bson.M{"$set": set, "$unset": bson.M{"lease_owner": ""}})
+	if err != nil {
+		log.Printf("refresh: failed to update job %s: %v", job.PlaylistID, err)
+	}
+	if _, err := config.DB.Collection("refresh_runs").InsertOne(saveCtx, run); err != nil {
+		log.Printf("refresh: failed to log run of %s: %v", job.PlaylistID, err)
+	}
+}
+
+// refreshPlaylist re-runs the blend stored with the playlist under a new
+// seed and brings the Spotify playlist in line with it. Tracks the new blend
+// keeps stay where they are, dropped ones are removed and new ones appended,
+// so only what changed moves. A blend with an explicit order is replaced
+// wholesale instead, as its sequence is the point.
+func refreshPlaylist(ctx context.Context, job *refreshJob, run *refreshRun) error {
+	user, err := loadUser(ctx, job.SpotifyID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return &requestError{status: http.StatusGone, msg: "user no longer exists"}
+	}
+	if err != nil {
+		return err
+	}
+	doc, err := ownedPlaylist(ctx, user, job.PlaylistID)
+	if err != nil {
+		return err
+	}
+	if doc.Request == nil {
+		return badRequest("playlist has no stored blend to refresh")
+	}
+	// Each run is a fresh shuffle of the same blend
+	req := *doc.Request
+	seed := newBlendSeed()
+	req.Seed = &seed
+	req.refreshing = job.PlaylistID
+	resp, err := generateBlend(ctx, user, &req)
+	if err != nil {
+		return err
+	}
+	run.Seed = seed
+
+	var want []string
+	for _, t := range resp.Tracks {
+		want = append(want, t.ID)
+	}
+	have, err := playlistTrackIDs(ctx, user, job.PlaylistID)
+	if err != nil {
+		return err
+	}
+	removed, added, kept := diffTracks(have, want)
+	run.Kept, run.Added, run.Removed = kept, len(added), len(removed)
+	replace := req.Order != "" && req.Order != blendOrder
+	if replace && slices.Equal(want, have) || !replace && len(removed) == 0 && len(added) == 0 {
+		run.Status = runUnchanged
+		return nil
+	}
+
+	var snapshot string
+	stored := want
+	if replace {
+		uris, _ := trackURIs(want)
+		snapshot, err = replacePlaylistTracks(ctx, user, job.PlaylistID, uris)
+	} else {
+		snapshot, err = patchPlaylistTracks(ctx, user, job.PlaylistID, removed, added)
+		stored = patchedOrder(have, want)
+	}
+	if err != nil {
+		return err
+	}
+	run.Status = runUpdated
+
+	byID := make(map[string]simplifiedTrack, len(resp.Tracks))
+	for _, t := range resp.Tracks {
+		byID[t.ID] = t
+	}
+	tracks := make([]simplifiedTrack, len(stored))
+	for i, id := range stored {
+		tracks[i] = byID[id]
+	}
+	now := time.Now()
+	set := bson.M{"track_ids": stored, "tracks": tracks, "updated_at": now, "refreshed_at": now}
+	if snapshot != "" {
+		set["snapshot_id"] = snapshot
+	}
+	_, err = config.DB.Collection("playlists").UpdateOne(ctx,
+		bson.M{"spotify_playlist_id": job.PlaylistID, "spotify_id": job.SpotifyID},
+		bson.M{"$set": set})
+	return err
+}
+
+// diffTracks works out how to turn a playlist holding have into want: the
+// URIs to remove, the URIs to append and how many wanted tracks are already
+// there. Each removed URI appears once, as removing takes out every copy.
+func diffTracks(have, want []string) (removed, added []string, kept int) {
+	wanted := make(map[string]bool, len(want))
+	for _, id := range want {
+		wanted[id] = true
+	}
+	present := make(map[string]bool, len(have))
+	for _, id := range have {
+		if !wanted[id] && !present[id] {
+			removed = append(removed, "spotify:track:"+id)
+		}
+		present[id] = true
+	}
+	for _, id := range want {
+		if present[id] {
+			kept++
+		} else {
+			added = append(added, "spotify:track:"+id)
+		}
+	}
+	return removed, added, kept
+}
+
+// patchedOrder is the order patchPlaylistTracks leaves a playlist in: the
+// tracks kept from have where they were, then the rest of want appended.
+func patchedOrder(have, want []string) []string {
+	wanted := make(map[string]bool, len(want))
+	for _, id := range want {
+		wanted[id] = true
+	}
+	var out []string
+	present := make(map[string]bool, len(have))
+	for _, id := range have {
+		if wanted[id] {
+			out = append(out, id)
+		}
+		present[id] = true
+	}
+	for _, id := range want {
+		if !present[id] {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// playlistTrackIDs lists the track IDs on a playlist in order, skipping
+// unavailable entries and episodes.
+func playlistTrackIDs(ctx context.Context, user *models.User, playlistID string) ([]string, error) {
+	var ids []string
+	err := withUserToken(ctx, user, func(token string) error {
+		ids = ids[:0]
+		for offset := 0; ; offset += 100 {
+			page, err := spotifyAPI().PlaylistTracks(ctx, token, playlistID, 100, offset)
+			if err != nil {
+				return err
+			}
+			for _, it := range page.Items {
+				if it.Track != nil && it.Track.ID != "" {
+					ids = append(ids, it.Track.ID)
+				}
+			}
+			if page.Next == "" {
+				return nil
+			}
+		}
+	})
+	return ids, err
+}
+
+// patchPlaylistTracks removes and then appends tracks, 100 per call, and
+// returns the final snapshot ID.
+func patchPlaylistTracks(ctx context.Context, user *models.User, playlistID string, remove, add []string) (string, error) {
+	snapshot := ""
+	for len(remove) > 0 {
+		batch := remove[:min(playlistBatchSize, len(remove))]
+		err := withUserToken(ctx, user, func(token string) error {
+			var err error
+			snapshot, err = spotifyAPI().RemovePlaylistTracks(ctx, token, playlistID, batch, snapshot)
+			return err
+		})
+		if err != nil {
+			return "", err
+		}
+		remove = remove[len(batch):]
+	}
+	_, snap, err := addTracksInBatches(ctx, user, playlistID, add)
+	if err != nil {
+		return "", err
+	}
+	if snap != "" {
+		snapshot = snap
+	}
+	return snapshot, nil
+}
+
+// replacePlaylistTracks swaps a playlist's contents for uris, 100 per call,
+// and returns the final snapshot ID.
+func replacePlaylistTracks(ctx context.Context, user *models.User, playlistID string, uris []string) (string, error) {
+	first := uris[:min(playlistBatchSize, len(uris))]
+	var snapshot string
+	err := withUserToken(ctx, user, func(token string) error {
+		var err error
+		snapshot, err = spotifyAPI().ReplacePlaylistTracks(ctx, token, playlistID, first)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	_, snap, err := addTracksInBatches(ctx, user, playlistID, uris[len(first):])
+	if err != nil {
+		return "", err
+	}
+	if snap != "" {
+		snapshot = snap
+	}
+	return snapshot, nil
+}
+
+func refreshPlaylistID(r *http.Request) string {
+	return strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/playlist/"), "/refresh")
+}
+
+// PUT /api/playlist/:id/refresh
+func SetPlaylistRefreshHandler(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Interval string `json:"interval"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	playlistID := refreshPlaylistID(r)
+	user := currentUser(r)
+	jobs := config.DB.Collection("refresh_jobs")
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if body.Interval == refreshOff {
+		if _, err := jobs.DeleteOne(ctx, bson.M{"_id": playlistID, "spotify_id": user.SpotifyID}); err != nil {
+			http.Error(w, "failed to disable auto-refresh", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	interval, ok := refreshInterval(body.Interval)
+	if !ok {
+		http.Error(w, "interval must be daily, weekly or off", http.StatusBadRequest)
+		return
+	}
+
+	doc, err := ownedPlaylist(ctx, user, playlistID)
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		http.Error(w, reqErr.msg, reqErr.status)
+		return
+	}
+	if err != nil {
+		writeSpotifyError(w, err, "failed to look up playlist")
+		return
+	}
+	if doc.Request == nil {
+		http.Error(w, "playlist has no stored blend; create it again to auto-refresh it", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	var job refreshJob
+	err = jobs.FindOneAndUpdate(ctx, bson.M{"_id": playlistID, "spotify_id": user.SpotifyID}, bson.M{
+		"$set": bson.M{
+			"interval":    body.Interval,
+			"next_run_at": now.Add(interval),
+			"failures":    0,
+			"disabled":    false,
+			"updated_at":  now,
+		},
+		"$setOnInsert": bson.M{"lease_until": time.Time{}, "created_at": now},
+	}, options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&job)
+	if err != nil {
+		http.Error(w, "failed to enable auto-refresh", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// GET /api/playlist/:id/refresh
+func GetPlaylistRefreshHandler(w http.ResponseWriter, r *http.Request) {
+	playlistID := refreshPlaylistID(r)
+	userID := currentUser(r).SpotifyID
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	var job *refreshJob
+	var j refreshJob
+	err := config.DB.Collection("refresh_jobs").FindOne(ctx, bson.M{"_id": playlistID, "spotify_id": userID}).Decode(&j)
+	switch {
+	case err == nil:
+		job = &j
+	case !errors.Is(err, mongo.ErrNoDocuments):
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		return
+	}
+
+	cur, err := config.DB.Collection("refresh_runs").Find(ctx,
+		bson.M{"playlist_id": playlistID, "spotify_id": userID},
+		options.Find().SetSort(bson.D{{Key: "started_at", Value: -1}}).SetLimit(refreshRunsShown))
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		return
+	}
+	defer cur.Close(ctx)
+	runs := []refreshRun{}
+	for cur.Next(ctx) {
+		var run refreshRun
+		if err := cur.Decode(&run); err == nil {
+			runs = append(runs, run)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Job  *refreshJob  `json:"job"`
+		Runs []refreshRun `json:"runs"`
+	}{job, runs})
+}
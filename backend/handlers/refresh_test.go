@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/Git-HimanshuRathi/artist-blend/backend/spotify"
+)
+
+func TestDiffTracks(t *testing.T) {
+	tests := []struct {
+		name           string
+		have, want     []string
+		removed, added []string
+		kept           int
+	}{
+		{"unchanged", []string{"a", "b"}, []string{"a", "b"}, nil, nil, 2},
+		{"reordered", []string{"a", "b"}, []string{"b", "a"}, nil, nil, 2},
+		{"empty playlist", nil, []string{"a", "b"}, nil, []string{"spotify:track:a", "spotify:track:b"}, 0},
+		{"emptied", []string{"a", "b"}, nil, []string{"spotify:track:a", "spotify:track:b"}, nil, 0},
+		{
+			"keeps, adds and removes",
+			[]string{"a", "b", "c"}, []string{"c", "d", "a", "e"},
+			[]string{"spotify:track:b"}, []string{"spotify:track:d", "spotify:track:e"}, 2,
+		},
+		{
+			"duplicates are removed once",
+			[]string{"a", "b", "a", "b"}, []string{"b"},
+			[]string{"spotify:track:a"}, nil, 1,
+		},
+	}
+	for _, tt := range tests {
+		removed, added, kept := diffTracks(tt.have, tt.want)
+		if !slices.Equal(removed, tt.removed) || !slices.Equal(added, tt.added) || kept != tt.kept {
+			t.Errorf("%s: got removed %v, added %v, kept %d; want %v, %v, %d",
+				tt.name, removed, added, kept, tt.removed, tt.added, tt.kept)
+		}
+	}
+}
+
+func TestPatchedOrder(t *testing.T) {
+	tests := []struct {
+		have, want, out []string
+	}{
+		{[]string{"a", "b", "c"}, []string{"c", "d", "a", "e"}, []string{"a", "c", "d", "e"}},
+		{[]string{"a", "b"}, []string{"b", "a"}, []string{"a", "b"}},
+		{nil, []string{"a", "b"}, []string{"a", "b"}},
+		{[]string{"a", "b", "a"}, []string{"a", "c"}, []string{"a", "a", "c"}},
+	}
+	for _, tt := range tests {
+		if got := patchedOrder(tt.have, tt.want); !slices.Equal(got, tt.out) {
+			t.Errorf("patchedOrder(%v, %v) = %v, want %v", tt.have, tt.want, got, tt.out)
+		}
+		// Refreshing again to the same blend must find nothing to do
+		if removed, added, _ := diffTracks(patchedOrder(tt.have, tt.want), tt.want); len(removed) != 0 || len(added) != 0 {
+			t.Errorf("after patching %v to %v: removed %v, added %v", tt.have, tt.want, removed, added)
+		}
+	}
+}
+
+func TestLibraryWithoutPlaylist(t *testing.T) {
+	track := func(id string) *spotify.Track {
+		return &spotify.Track{ID: id, Name: "Song " + id, Artists: []spotify.Artist{{ID: "artist"}}}
+	}
+	lib := &userLibrary{keys: make(map[string]int), playlists: make(map[string]map[string]struct{})}
+	lib.addTrack(track("saved"), nil)
+	for _, p := range []struct {
+		id     string
+		tracks []string
+	}{
+		{"refreshed", []string{"saved", "only-here", "only-here", "shared"}},
+		{"other", []string{"shared"}},
+	} {
+		in := make(map[string]struct{})
+		lib.playlists[p.id] = in
+		for _, id := range p.tracks {
+			lib.addTrack(track(id), in)
+		}
+	}
+
+	view := lib.without("refreshed")
+	for id, known := range map[string]bool{"saved": true, "shared": true, "only-here": false, "unknown": false} {
+		if got := view.has(*track(id)); got != known {
+			t.Errorf("without refreshed: has(%s) = %v, want %v", id, got, known)
+		}
+	}
+	if !lib.has(*track("only-here")) {
+		t.Error("the full library lost a track to a view of it")
+	}
+}
+
+func TestDisablesRefresh(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&requestError{status: http.StatusGone, msg: "user no longer exists"}, true},
+		{&requestError{status: http.StatusNotFound, msg: "playlist no longer exists on Spotify"}, true},
+		{fmt.Errorf("refreshing: %w", errNoRefreshToken), true},
+		{badRequest("could not resolve any artist seeds"), false},
+		{&requestError{status: http.StatusUnauthorized, msg: "log in to personalise the blend"}, false},
+		{errors.New("spotify: 502 Bad Gateway"), false},
+	}
+	for _, tt := range tests {
+		if got := disablesRefresh(tt.err); got != tt.want {
+			t.Errorf("disablesRefresh(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
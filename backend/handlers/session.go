@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Git-HimanshuRathi/artist-blend/backend/config"
+	"github.com/Git-HimanshuRathi/artist-blend/backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	sessionCookieName = "ab_sid"
+	sessionTTL        = 7 * 24 * time.Hour
+)
+
+var errNoSession = errors.New("no valid session")
+
+type userContextKey struct{}
+
+// EnsureSessionIndexes creates the indexes the sessions collection relies on.
+// The TTL index lets MongoDB purge expired sessions on its own.
+func EnsureSessionIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := config.DB.Collection("sessions").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		{Keys: bson.D{{Key: "spotify_id", Value: 1}}},
+	})
+	return err
+}
+
+func hashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newSessionToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// createSession stores a new session for spotifyID and returns the opaque
+// token to hand to the browser.
+func createSession(ctx context.Context, spotifyID string) (string, error) {
+	token, err := newSessionToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	sess := models.Session{
+		ID:        hashSessionToken(token),
+		SpotifyID: spotifyID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(sessionTTL),
+	}
+	if _, err := config.DB.Collection("sessions").InsertOne(ctx, sess); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func deleteSession(ctx context.Context, token string) error {
+	_, err := config.DB.Collection("sessions").DeleteOne(ctx, bson.M{"_id": hashSessionToken(token)})
+	return err
+}
+
+func lookupSession(ctx context.Context, token string) (*models.Session, error) {
+	var sess models.Session
+	err := config.DB.Collection("sessions").FindOne(ctx, bson.M{
+		"_id":        hashSessionToken(token),
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&sess)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, errNoSession
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sess, nil
+}
+
+func setSessionCookie(w http.ResponseWriter, token string) {
+	secure, sameSite := getCookiePolicy()
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: sameSite,
+		MaxAge:   int(sessionTTL.Seconds()),
+	})
+}
+
+func clearSessionCookie(w http.ResponseWriter) {
+	secure, sameSite := getCookiePolicy()
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: sameSite,
+		MaxAge:   -1,
+	})
+}
+
+// userFromRequest resolves the user behind the session cookie on r.
+func userFromRequest(r *http.Request) (*models.User, error) {
+	c, err := r.Cookie(sessionCookieName)
+	if err != nil || c.Value == "" {
+		return nil, errNoSession
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	sess, err := lookupSession(ctx, c.Value)
+	if err != nil {
+		return nil, err
+	}
+	var user models.User
+	err = config.DB.Collection("users").FindOne(ctx, bson.M{"spotify_id": sess.SpotifyID}).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, errNoSession
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// RequireUser resolves the logged-in user from the session cookie and makes
+// it available to next via currentUser. Requests without a valid session are
+// rejected with 401.
+func RequireUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := userFromRequest(r)
+		if errors.Is(err, errNoSession) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			http.Error(w, "failed to load session", http.StatusInternalServerError)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), userContextKey{}, user)))
+	}
+}
+
+// OptionalUser is RequireUser for endpoints that also serve anonymous
+// requests: without a session next runs with no user attached.
+func OptionalUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := userFromRequest(r)
+		if errors.Is(err, errNoSession) {
+			next(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, "failed to load session", http.StatusInternalServerError)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), userContextKey{}, user)))
+	}
+}
+
+// currentUser returns the user attached by RequireUser or OptionalUser, or nil.
+func currentUser(r *http.Request) *models.User {
+	user, _ := r.Context().Value(userContextKey{}).(*models.User)
+	return user
+}
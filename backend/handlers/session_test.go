@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Git-HimanshuRathi/artist-blend/backend/config"
+	"github.com/Git-HimanshuRathi/artist-blend/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// mockDB points config.DB at mt's mock deployment for the rest of the test.
+func mockDB(mt *mtest.T) {
+	prev := config.DB
+	config.DB = mt.DB
+	mt.Cleanup(func() { config.DB = prev })
+}
+
+func TestHashSessionToken(t *testing.T) {
+	token, err := newSessionToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := newSessionToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token == other || len(token) != 43 {
+		t.Errorf("tokens %q and %q, want two distinct 43-character tokens", token, other)
+	}
+	h := hashSessionToken(token)
+	if len(h) != 64 || h == token || h != hashSessionToken(token) || h == hashSessionToken(other) {
+		t.Errorf("hashSessionToken(%q) = %q, want a stable 64-digit hex digest", token, h)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	ns := "artistblend_test.sessions"
+
+	mt.Run("create stores only the hash", func(mt *mtest.T) {
+		mockDB(mt)
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		token, err := createSession(context.Background(), "alice")
+		if err != nil {
+			mt.Fatal(err)
+		}
+		doc := mt.GetStartedEvent().Command.Lookup("documents").Array().Index(0).Value().Document()
+		if id := doc.Lookup("_id").StringValue(); id != hashSessionToken(token) {
+			mt.Errorf("stored _id %q, want the token's hash", id)
+		}
+		expires := doc.Lookup("expires_at").Time()
+		if d := time.Until(expires); d < sessionTTL-time.Minute || d > sessionTTL {
+			mt.Errorf("session expires in %v, want %v", d, sessionTTL)
+		}
+	})
+
+	mt.Run("lookup skips expired sessions", func(mt *mtest.T) {
+		mockDB(mt)
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{
+			{Key: "_id", Value: hashSessionToken("token")}, {Key: "spotify_id", Value: "alice"},
+		}))
+		sess, err := lookupSession(context.Background(), "token")
+		if err != nil || sess.SpotifyID != "alice" {
+			mt.Fatalf("got %+v, %v", sess, err)
+		}
+		filter := mt.GetStartedEvent().Command.Lookup("filter").Document()
+		if id := filter.Lookup("_id").StringValue(); id != hashSessionToken("token") {
+			mt.Errorf("looked up _id %q, want the token's hash", id)
+		}
+		after := filter.Lookup("expires_at", "$gt").Time()
+		if d := time.Since(after); d < 0 || d > time.Minute {
+			mt.Errorf("expires_at must be after %v, want about now", after)
+		}
+	})
+
+	mt.Run("lookup of an unknown or expired session", func(mt *mtest.T) {
+		mockDB(mt)
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch))
+		if _, err := lookupSession(context.Background(), "token"); !errors.Is(err, errNoSession) {
+			mt.Errorf("err = %v, want %v", err, errNoSession)
+		}
+	})
+}
+
+func TestRequireUser(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	sessionDoc := bson.D{{Key: "_id", Value: hashSessionToken("token")}, {Key: "spotify_id", Value: "alice"}}
+	userDoc := bson.D{{Key: "spotify_id", Value: "alice"}}
+
+	tests := []struct {
+		name      string
+		cookie    string
+		responses []bson.D
+		status    int
+	}{
+		{"no cookie", "", nil, http.StatusUnauthorized},
+		{"unknown session", "token", []bson.D{
+			mtest.CreateCursorResponse(0, "artistblend_test.sessions", mtest.FirstBatch),
+		}, http.StatusUnauthorized},
+		{"user gone", "token", []bson.D{
+			mtest.CreateCursorResponse(0, "artistblend_test.sessions", mtest.FirstBatch, sessionDoc),
+			mtest.CreateCursorResponse(0, "artistblend_test.users", mtest.FirstBatch),
+		}, http.StatusUnauthorized},
+		{"database down", "token", []bson.D{
+			mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 91, Message: "shutting down"}),
+		}, http.StatusInternalServerError},
+		{"valid session", "token", []bson.D{
+			mtest.CreateCursorResponse(0, "artistblend_test.sessions", mtest.FirstBatch, sessionDoc),
+			mtest.CreateCursorResponse(0, "artistblend_test.users", mtest.FirstBatch, userDoc),
+		}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mockDB(mt)
+			mt.AddMockResponses(tt.responses...)
+			var user *models.User
+			h := RequireUser(func(w http.ResponseWriter, r *http.Request) { user = currentUser(r) })
+
+			r := httptest.NewRequest(http.MethodGet, "/api/auth/me", nil)
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: sessionCookieName, Value: tt.cookie})
+			}
+			w := httptest.NewRecorder()
+			h(w, r)
+			if w.Code != tt.status {
+				mt.Errorf("status %d, want %d", w.Code, tt.status)
+			}
+			if tt.status == http.StatusOK && (user == nil || user.SpotifyID != "alice") {
+				mt.Errorf("handler got user %+v, want alice", user)
+			}
+			if tt.status != http.StatusOK && user != nil {
+				mt.Errorf("rejected request reached the handler")
+			}
+		})
+	}
+}
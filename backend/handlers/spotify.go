@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Git-HimanshuRathi/artist-blend/backend/spotify"
+)
+
+// defaultMarket is the market used for catalogue lookups.
+const defaultMarket = "US"
+
+// spotifyAPI is the shared Spotify client. It is built lazily so the
+// SPOTIFY_API_BASE_URL / SPOTIFY_ACCOUNTS_BASE_URL overrides can come from
+// the .env file loaded at startup.
+var spotifyAPI = sync.OnceValue(func() *spotify.Client {
+	// Client-side budget shared by every Spotify call this process makes
+	perSecond := 10.0
+	if v, err := strconv.ParseFloat(os.Getenv("SPOTIFY_REQUESTS_PER_SECOND"), 64); err == nil && v > 0 {
+		perSecond = v
+	}
+	transport := &spotify.Transport{
+		Budget: spotify.NewBudget(perSecond, int(perSecond*2), 5*time.Second),
+	}
+
+	c := spotify.NewClient(&http.Client{Timeout: 30 * time.Second, Transport: transport})
+	if v := os.Getenv("SPOTIFY_API_BASE_URL"); v != "" {
+		c.BaseURL = v
+	}
+	if v := os.Getenv("SPOTIFY_ACCOUNTS_BASE_URL"); v != "" {
+		c.AccountsURL = v
+	}
+	return c
+})
+
+// writeSpotifyError reports a failed Spotify call. Throttling gets a 503 with
+// a Retry-After hint so clients can back off; anything else is a 502 with msg.
+func writeSpotifyError(w http.ResponseWriter, err error, msg string) {
+	var te *spotify.ThrottledError
+	if errors.As(err, &te) {
+		secs := int(te.RetryAfter.Seconds())
+		if secs < 1 {
+			secs = 1
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(secs))
+		http.Error(w, "upstream throttled, retry later", http.StatusServiceUnavailable)
+		return
+	}
+	http.Error(w, msg, http.StatusBadGateway)
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/Git-HimanshuRathi/artist-blend/backend/config"
+	"github.com/Git-HimanshuRathi/artist-blend/backend/models"
+	"github.com/Git-HimanshuRathi/artist-blend/backend/spotify"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// tokenRefreshMargin is how long before expiry a user token is refreshed.
+const tokenRefreshMargin = 60 * time.Second
+
+var errNoRefreshToken = errors.New("user has no refresh token")
+
+// requestSpotifyToken posts form to the Spotify token endpoint using the app
+// credentials.
+func requestSpotifyToken(ctx context.Context, form url.Values) (*spotify.Token, error) {
+	clientID := os.Getenv("SPOTIFY_CLIENT_ID")
+	clientSecret := os.Getenv("SPOTIFY_CLIENT_SECRET")
+	if clientID == "" || clientSecret == "" {
+		return nil, fmt.Errorf("missing Spotify credentials")
+	}
+	return spotifyAPI().RequestToken(ctx, clientID, clientSecret, form)
+}
+
+// userTokenManager hands out valid Spotify access tokens for logged-in users,
+// refreshing them with the stored refresh token when they are about to expire.
+// Refreshes are serialised per user so concurrent requests share one refresh.
+type userTokenManager struct {
+	locks keyedMutex
+}
+
+var userTokens = &userTokenManager{}
+
+func tokenFresh(user *models.User) bool {
+	return user.AccessToken != "" && time.Until(user.TokenExpiresAt) > tokenRefreshMargin
+}
+
+// AccessToken returns a usable access token for user, refreshing it first if
+// it is expired or close to expiry. user is updated in place.
+func (m *userTokenManager) AccessToken(ctx context.Context, user *models.User) (string, error) {
+	if tokenFresh(user) {
+		return user.AccessToken, nil
+	}
+	return m.refresh(ctx, user, user.AccessToken)
+}
+
+// Refresh forces a refresh after Spotify rejected stale with a 401. If another
+// request already replaced stale, the newer token is returned instead.
+func (m *userTokenManager) Refresh(ctx context.Context, user *models.User, stale string) (string, error) {
+	return m.refresh(ctx, user, stale)
+}
+
+func (m *userTokenManager) refresh(ctx context.Context, user *models.User, stale string) (string, error) {
+	defer m.locks.Lock(user.SpotifyID)()
+
+	// Another request may have refreshed while we waited for the lock
+	coll := config.DB.Collection("users")
+	var latest models.User
+	if err := coll.FindOne(ctx, bson.M{"spotify_id": user.SpotifyID}).Decode(&latest); err != nil {
+		return "", err
+	}
+	if latest.AccessToken != stale && tokenFresh(&latest) {
+		*user = latest
+		return latest.AccessToken, nil
+	}
+	if latest.RefreshToken == "" {
+		return "", errNoRefreshToken
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", latest.RefreshToken)
+	tok, err := requestSpotifyToken(ctx, form)
+	if err != nil {
+		return "", err
+	}
+
+	latest.AccessToken = tok.AccessToken
+	latest.TokenExpiresAt = tok.ExpiresAt()
+	latest.UpdatedAt = time.Now()
+	set := bson.M{
+		"access_token":     latest.AccessToken,
+		"token_expires_at": latest.TokenExpiresAt,
+		"updated_at":       latest.UpdatedAt,
+	}
+	// Spotify only sometimes rotates the refresh token
+	if tok.RefreshToken != "" {
+		latest.RefreshToken = tok.RefreshToken
+		set["refresh_token"] = tok.RefreshToken
+	}
+	if _, err := coll.UpdateOne(ctx, bson.M{"spotify_id": user.SpotifyID}, bson.M{"$set": set}); err != nil {
+		return "", err
+	}
+	*user = latest
+	return latest.AccessToken, nil
+}
+
+// withUserToken calls fn with an access token for user. The token is
+// refreshed ahead of expiry and, if Spotify still answers 401, refreshed once
+// more and fn retried.
+func withUserToken(ctx context.Context, user *models.User, fn func(token string) error) error {
+	token, err := userTokens.AccessToken(ctx, user)
+	if err != nil {
+		return err
+	}
+	err = fn(token)
+	if !spotify.IsStatus(err, http.StatusUnauthorized) {
+		return err
+	}
+	token, err = userTokens.Refresh(ctx, user, token)
+	if err != nil {
+		return err
+	}
+	return fn(token)
+}
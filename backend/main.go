@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 
@@ -14,6 +15,16 @@ func main() {
 	gin.SetMode(gin.ReleaseMode)
 
 	config.ConnectDB()
+	if err := handlers.EnsureSessionIndexes(); err != nil {
+		log.Printf("Failed to create session indexes: %v", err)
+	}
+	if err := handlers.EnsureFriendIndexes(); err != nil {
+		log.Printf("Failed to create friend blend indexes: %v", err)
+	}
+	if err := handlers.EnsureRefreshIndexes(); err != nil {
+		log.Printf("Failed to create refresh indexes: %v", err)
+	}
+	handlers.StartRefreshScheduler(context.Background())
 
 	router := gin.Default()
 
@@ -58,17 +69,22 @@ func main() {
 		})
 	})
 
-	router.GET("/api/auth/me", gin.WrapF(handlers.MeHandler))
+	// Debug endpoints are only served when DEBUG is set, and only to users
+	if os.Getenv("DEBUG") != "" {
+		router.GET("/api/debug/app-token", gin.WrapF(handlers.RequireUser(handlers.AppTokenDebugHandler)))
+	}
+
+	router.GET("/api/auth/me", gin.WrapF(handlers.RequireUser(handlers.MeHandler)))
 
 	router.GET("/api/search/artists", gin.WrapF(handlers.SearchArtistsHandler))
 
-	router.POST("/api/playlist/generate", gin.WrapF(handlers.GeneratePlaylistHandler))
-	router.POST("/api/playlist/create", gin.WrapF(handlers.CreatePlaylistHandler))
+	router.POST("/api/playlist/generate", gin.WrapF(handlers.OptionalUser(handlers.GeneratePlaylistHandler)))
+	router.POST("/api/playlist/create", gin.WrapF(handlers.RequireUser(handlers.CreatePlaylistHandler)))
 
-	router.GET("/api/history", gin.WrapF(handlers.ListHistoryHandler))
-	router.POST("/api/history", gin.WrapF(handlers.SaveHistoryHandler))
+	router.GET("/api/history", gin.WrapF(handlers.RequireUser(handlers.ListHistoryHandler)))
+	router.POST("/api/history", gin.WrapF(handlers.RequireUser(handlers.SaveHistoryHandler)))
 	router.DELETE("/api/history/:id", func(c *gin.Context) {
-		handlers.DeleteHistoryHandler(c.Writer, c.Request)
+		handlers.RequireUser(handlers.DeleteHistoryHandler)(c.Writer, c.Request)
 	})
 
 	router.POST("/api/playlist/save", func(c *gin.Context) {
@@ -84,7 +100,25 @@ func main() {
 		})
 	})
 
-	router.GET("/api/playlist/user", gin.WrapF(handlers.ListUserPlaylistsHandler))
+	router.GET("/api/playlist/user", gin.WrapF(handlers.RequireUser(handlers.ListUserPlaylistsHandler)))
+	router.GET("/api/playlist/:id/refresh", func(c *gin.Context) {
+		handlers.RequireUser(handlers.GetPlaylistRefreshHandler)(c.Writer, c.Request)
+	})
+	router.PUT("/api/playlist/:id/refresh", func(c *gin.Context) {
+		handlers.RequireUser(handlers.SetPlaylistRefreshHandler)(c.Writer, c.Request)
+	})
+
+	router.POST("/api/friends/invites", gin.WrapF(handlers.RequireUser(handlers.CreateInviteHandler)))
+	router.GET("/api/friends/invites/:code", func(c *gin.Context) {
+		handlers.RequireUser(handlers.GetInviteHandler)(c.Writer, c.Request)
+	})
+	router.POST("/api/friends/invites/:code/accept", func(c *gin.Context) {
+		handlers.RequireUser(handlers.AcceptInviteHandler)(c.Writer, c.Request)
+	})
+	router.GET("/api/friends/blends", gin.WrapF(handlers.RequireUser(handlers.ListFriendBlendsHandler)))
+	router.GET("/api/friends/blends/:id", func(c *gin.Context) {
+		handlers.RequireUser(handlers.GetFriendBlendHandler)(c.Writer, c.Request)
+	})
 
 	// Get port from environment variable (Render uses PORT)
 	if port == "" {
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Session is a server-side login session. ID holds the SHA-256 of the opaque
+// token stored in the ab_sid cookie, never the token itself.
+type Session struct {
+	ID        string    `bson:"_id"`
+	SpotifyID string    `bson:"spotify_id"`
+	CreatedAt time.Time `bson:"created_at"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
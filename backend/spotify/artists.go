@@ -0,0 +1,122 @@
+package spotify
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// SearchArtists runs an artist search and returns the first page of results.
+func (c *Client) SearchArtists(ctx context.Context, token, query string, limit int) (*Paging[Artist], error) {
+	q := url.Values{}
+	q.Set("type", "artist")
+	q.Set("q", query)
+	q.Set("limit", strconv.Itoa(limit))
+	var payload struct {
+		Artists Paging[Artist] `json:"artists"`
+	}
+	if err := c.get(ctx, token, "/search", q, &payload); err != nil {
+		return nil, err
+	}
+	return &payload.Artists, nil
+}
+
+// Artists fetches full artist objects. Spotify accepts at most 50 IDs per
+// call; unknown IDs are left out of the result.
+func (c *Client) Artists(ctx context.Context, token string, ids []string) ([]Artist, error) {
+	q := url.Values{}
+	q.Set("ids", strings.Join(ids, ","))
+	var payload struct {
+		Artists []*Artist `json:"artists"`
+	}
+	if err := c.get(ctx, token, "/artists", q, &payload); err != nil {
+		return nil, err
+	}
+	artists := make([]Artist, 0, len(payload.Artists))
+	for _, a := range payload.Artists {
+		if a != nil {
+			artists = append(artists, *a)
+		}
+	}
+	return artists, nil
+}
+
+// ArtistTopTracks returns an artist's top tracks in market.
+func (c *Client) ArtistTopTracks(ctx context.Context, token, artistID, market string) ([]Track, error) {
+	q := url.Values{}
+	q.Set("market", market)
+	var payload struct {
+		Tracks []Track `json:"tracks"`
+	}
+	if err := c.get(ctx, token, "/artists/"+url.PathEscape(artistID)+"/top-tracks", q, &payload); err != nil {
+		return nil, err
+	}
+	return payload.Tracks, nil
+}
+
+// RelatedArtists returns the artists Spotify considers similar to artistID.
+func (c *Client) RelatedArtists(ctx context.Context, token, artistID string) ([]Artist, error) {
+	var payload struct {
+		Artists []Artist `json:"artists"`
+	}
+	if err := c.get(ctx, token, "/artists/"+url.PathEscape(artistID)+"/related-artists", nil, &payload); err != nil {
+		return nil, err
+	}
+	return payload.Artists, nil
+}
+
+// ArtistAlbumsOptions narrows ArtistAlbums. IncludeGroups takes Spotify's
+// values: album, single, appears_on, compilation.
+type ArtistAlbumsOptions struct {
+	IncludeGroups []string
+	Market        string
+	Limit         int
+	Offset        int
+}
+
+// ArtistAlbums returns one page of an artist's albums.
+func (c *Client) ArtistAlbums(ctx context.Context, token, artistID string, opts ArtistAlbumsOptions) (*Paging[Album], error) {
+	q := url.Values{}
+	if len(opts.IncludeGroups) > 0 {
+		q.Set("include_groups", strings.Join(opts.IncludeGroups, ","))
+	}
+	if opts.Market != "" {
+		q.Set("market", opts.Market)
+	}
+	if opts.Limit > 0 {
+		q.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Offset > 0 {
+		q.Set("offset", strconv.Itoa(opts.Offset))
+	}
+	var page Paging[Album]
+	if err := c.get(ctx, token, "/artists/"+url.PathEscape(artistID)+"/albums", q, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// Albums fetches full albums, including their first page of tracks. Spotify
+// accepts at most 20 IDs per call.
+func (c *Client) Albums(ctx context.Context, token string, ids []string, market string) ([]Album, error) {
+	q := url.Values{}
+	q.Set("ids", strings.Join(ids, ","))
+	if market != "" {
+		q.Set("market", market)
+	}
+	var payload struct {
+		Albums []*Album `json:"albums"`
+	}
+	if err := c.get(ctx, token, "/albums", q, &payload); err != nil {
+		return nil, err
+	}
+	albums := make([]Album, 0, len(payload.Albums))
+	for _, a := range payload.Albums {
+		// Unknown IDs come back as null
+		if a != nil {
+			albums = append(albums, *a)
+		}
+	}
+	return albums, nil
+}
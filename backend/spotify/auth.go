@@ -0,0 +1,56 @@
+package spotify
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Token is a response from the accounts service token endpoint.
+type Token struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	Scope        string `json:"scope"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// ExpiresAt converts ExpiresIn into an absolute time, measured from now.
+func (t *Token) ExpiresAt() time.Time {
+	return time.Now().Add(time.Duration(t.ExpiresIn) * time.Second)
+}
+
+func (c *Client) accountsURL(path string) string {
+	base := c.AccountsURL
+	if base == "" {
+		base = DefaultAccountsURL
+	}
+	return strings.TrimRight(base, "/") + path
+}
+
+// AuthorizeURL builds the URL the browser is sent to for user consent.
+func (c *Client) AuthorizeURL(params url.Values) string {
+	return c.accountsURL("/authorize") + "?" + params.Encode()
+}
+
+// RequestToken posts form to the token endpoint, authenticating with the app
+// credentials. form carries the grant_type and its parameters.
+func (c *Client) RequestToken(ctx context.Context, clientID, clientSecret string, form url.Values) (*Token, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.accountsURL("/api/token"), strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(clientID, clientSecret)
+
+	var tok Token
+	if err := c.do(req, &tok); err != nil {
+		return nil, err
+	}
+	if tok.AccessToken == "" {
+		return nil, &Error{Status: http.StatusBadGateway, Message: "missing access_token in response"}
+	}
+	return &tok, nil
+}
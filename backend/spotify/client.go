@@ -0,0 +1,150 @@
+// Package spotify is a small typed client for the parts of the Spotify Web
+// API that ArtistBlend uses.
+package spotify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	DefaultBaseURL     = "https://api.spotify.com/v1"
+	DefaultAccountsURL = "https://accounts.spotify.com"
+)
+
+// Client talks to the Spotify Web API. BaseURL and AccountsURL can be pointed
+// at a local fake; the zero value of either falls back to the real service.
+type Client struct {
+	BaseURL     string
+	AccountsURL string
+	HTTPClient  *http.Client
+}
+
+// NewClient returns a Client for the real Spotify endpoints. A nil
+// httpClient means http.DefaultClient.
+func NewClient(httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		BaseURL:     DefaultBaseURL,
+		AccountsURL: DefaultAccountsURL,
+		HTTPClient:  httpClient,
+	}
+}
+
+// Error is returned for any non-2xx response from Spotify.
+type Error struct {
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("spotify: status %d", e.Status)
+	}
+	return fmt.Sprintf("spotify: status %d: %s", e.Status, e.Message)
+}
+
+// IsStatus reports whether err is a Spotify error with the given HTTP status.
+func IsStatus(err error, status int) bool {
+	var se *Error
+	return errors.As(err, &se) && se.Status == status
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (c *Client) apiURL(path string, query url.Values) string {
+	base := c.BaseURL
+	if base == "" {
+		base = DefaultBaseURL
+	}
+	u := strings.TrimRight(base, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+// do sends req and decodes a JSON response into out (if non-nil).
+func (c *Client) do(req *http.Request, out any) error {
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return newError(resp)
+	}
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func newError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	// API errors look like {"error":{"status":..,"message":..}}, token
+	// endpoint errors like {"error":"..","error_description":".."}
+	var payload struct {
+		Error            json.RawMessage `json:"error"`
+		ErrorDescription string          `json:"error_description"`
+	}
+	msg := strings.TrimSpace(string(body))
+	if json.Unmarshal(body, &payload) == nil && len(payload.Error) > 0 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		var code string
+		switch {
+		case json.Unmarshal(payload.Error, &apiErr) == nil && apiErr.Message != "":
+			msg = apiErr.Message
+		case json.Unmarshal(payload.Error, &code) == nil:
+			msg = strings.TrimSpace(code + " " + payload.ErrorDescription)
+		}
+	}
+	return &Error{Status: resp.StatusCode, Message: msg}
+}
+
+func (c *Client) get(ctx context.Context, token, path string, query url.Values, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.apiURL(path, query), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return c.do(req, out)
+}
+
+func (c *Client) send(ctx context.Context, token, method, path string, body, out any) error {
+	var rd io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rd = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.apiURL(path, nil), rd)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return c.do(req, out)
+}
@@ -0,0 +1,100 @@
+package spotify
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+)
+
+// Me returns the profile of the user the token belongs to.
+func (c *Client) Me(ctx context.Context, token string) (*User, error) {
+	var u User
+	if err := c.get(ctx, token, "/me", nil, &u); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// UserPlaylists returns one page of the current user's playlists.
+func (c *Client) UserPlaylists(ctx context.Context, token string, limit, offset int) (*Paging[Playlist], error) {
+	q := url.Values{}
+	q.Set("limit", strconv.Itoa(limit))
+	q.Set("offset", strconv.Itoa(offset))
+	var page Paging[Playlist]
+	if err := c.get(ctx, token, "/me/playlists", q, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// SavedTrack is a track in the user's library.
+type SavedTrack struct {
+	AddedAt string `json:"added_at"`
+	Track   Track  `json:"track"`
+}
+
+// SavedTracks returns one page of the current user's saved tracks.
+func (c *Client) SavedTracks(ctx context.Context, token string, limit, offset int) (*Paging[SavedTrack], error) {
+	q := url.Values{}
+	q.Set("limit", strconv.Itoa(limit))
+	q.Set("offset", strconv.Itoa(offset))
+	var page Paging[SavedTrack]
+	if err := c.get(ctx, token, "/me/tracks", q, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// PlayHistory is one play from the user's recently played tracks.
+type PlayHistory struct {
+	PlayedAt string `json:"played_at"`
+	Track    Track  `json:"track"`
+}
+
+// RecentlyPlayed returns up to limit (at most 50) of the current user's most
+// recent plays. Spotify keeps no more than the last 50.
+func (c *Client) RecentlyPlayed(ctx context.Context, token string, limit int) ([]PlayHistory, error) {
+	q := url.Values{}
+	q.Set("limit", strconv.Itoa(limit))
+	var payload struct {
+		Items []PlayHistory `json:"items"`
+	}
+	if err := c.get(ctx, token, "/me/player/recently-played", q, &payload); err != nil {
+		return nil, err
+	}
+	return payload.Items, nil
+}
+
+// Time ranges for TopArtists and TopTracks: roughly the last four weeks, six
+// months and several years.
+const (
+	ShortTerm  = "short_term"
+	MediumTerm = "medium_term"
+	LongTerm   = "long_term"
+)
+
+// TopArtists returns the current user's most listened-to artists over
+// timeRange, best first. limit is at most 50.
+func (c *Client) TopArtists(ctx context.Context, token, timeRange string, limit int) (*Paging[Artist], error) {
+	q := url.Values{}
+	q.Set("time_range", timeRange)
+	q.Set("limit", strconv.Itoa(limit))
+	var page Paging[Artist]
+	if err := c.get(ctx, token, "/me/top/artists", q, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// TopTracks returns the current user's most listened-to tracks over
+// timeRange, best first. limit is at most 50.
+func (c *Client) TopTracks(ctx context.Context, token, timeRange string, limit int) (*Paging[Track], error) {
+	q := url.Values{}
+	q.Set("time_range", timeRange)
+	q.Set("limit", strconv.Itoa(limit))
+	var page Paging[Track]
+	if err := c.get(ctx, token, "/me/top/tracks", q, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
@@ -0,0 +1,127 @@
+package spotify
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// PlaylistDetails are the attributes sent when creating a playlist.
+type PlaylistDetails struct {
+	Name          string `json:"name"`
+	Description   string `json:"description,omitempty"`
+	Public        bool   `json:"public"`
+	Collaborative bool   `json:"collaborative,omitempty"`
+}
+
+// CreatePlaylist creates a playlist owned by userID.
+func (c *Client) CreatePlaylist(ctx context.Context, token, userID string, details PlaylistDetails) (*Playlist, error) {
+	var p Playlist
+	if err := c.send(ctx, token, http.MethodPost, "/users/"+url.PathEscape(userID)+"/playlists", details, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+type snapshotResponse struct {
+	SnapshotID string `json:"snapshot_id"`
+}
+
+// AddTracksToPlaylist appends uris (at most 100) to a playlist and returns
+// the new snapshot ID.
+func (c *Client) AddTracksToPlaylist(ctx context.Context, token, playlistID string, uris []string) (string, error) {
+	var snap snapshotResponse
+	body := map[string]any{"uris": uris}
+	if err := c.send(ctx, token, http.MethodPost, "/playlists/"+url.PathEscape(playlistID)+"/tracks", body, &snap); err != nil {
+		return "", err
+	}
+	return snap.SnapshotID, nil
+}
+
+// ReplacePlaylistTracks swaps a playlist's entire contents for uris (at most
+// 100; an empty list clears it) and returns the new snapshot ID.
+func (c *Client) ReplacePlaylistTracks(ctx context.Context, token, playlistID string, uris []string) (string, error) {
+	var snap snapshotResponse
+	if uris == nil {
+		uris = []string{}
+	}
+	body := map[string]any{"uris": uris}
+	if err := c.send(ctx, token, http.MethodPut, "/playlists/"+url.PathEscape(playlistID)+"/tracks", body, &snap); err != nil {
+		return "", err
+	}
+	return snap.SnapshotID, nil
+}
+
+// RemovePlaylistTracks removes every occurrence of uris (at most 100) from a
+// playlist and returns the new snapshot ID. A non-empty snapshotID makes
+// Spotify apply the removal to that version of the playlist.
+func (c *Client) RemovePlaylistTracks(ctx context.Context, token, playlistID string, uris []string, snapshotID string) (string, error) {
+	type trackRef struct {
+		URI string `json:"uri"`
+	}
+	tracks := make([]trackRef, len(uris))
+	for i, u := range uris {
+		tracks[i] = trackRef{URI: u}
+	}
+	body := map[string]any{"tracks": tracks}
+	if snapshotID != "" {
+		body["snapshot_id"] = snapshotID
+	}
+	var snap snapshotResponse
+	if err := c.send(ctx, token, http.MethodDelete, "/playlists/"+url.PathEscape(playlistID)+"/tracks", body, &snap); err != nil {
+		return "", err
+	}
+	return snap.SnapshotID, nil
+}
+
+// Playlist fetches a playlist's details, including its owner.
+func (c *Client) Playlist(ctx context.Context, token, playlistID string) (*Playlist, error) {
+	q := url.Values{}
+	q.Set("fields", "id,name,description,public,collaborative,owner,snapshot_id,uri,external_urls")
+	var p Playlist
+	if err := c.get(ctx, token, "/playlists/"+url.PathEscape(playlistID), q, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// PlaylistItem is one entry of a playlist. Track is nil for entries that
+// are no longer available, and episodes decode with an empty track ID.
+type PlaylistItem struct {
+	AddedAt string `json:"added_at"`
+	Track   *Track `json:"track"`
+}
+
+// PlaylistTracks returns one page (at most 100 entries) of a playlist.
+func (c *Client) PlaylistTracks(ctx context.Context, token, playlistID string, limit, offset int) (*Paging[PlaylistItem], error) {
+	q := url.Values{}
+	q.Set("limit", strconv.Itoa(limit))
+	q.Set("offset", strconv.Itoa(offset))
+	var page Paging[PlaylistItem]
+	if err := c.get(ctx, token, "/playlists/"+url.PathEscape(playlistID)+"/tracks", q, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// UnfollowPlaylist removes a playlist from the current user's library. For
+// the owner this is as close to deleting it as the API allows.
+func (c *Client) UnfollowPlaylist(ctx context.Context, token, playlistID string) error {
+	return c.send(ctx, token, http.MethodDelete, "/playlists/"+url.PathEscape(playlistID)+"/followers", nil, nil)
+}
+
+// UploadPlaylistCover sets a playlist's cover to a JPEG image. Spotify takes
+// it base64-encoded, at most 256KB, and needs the ugc-image-upload scope.
+func (c *Client) UploadPlaylistCover(ctx context.Context, token, playlistID string, jpeg []byte) error {
+	body := base64.StdEncoding.EncodeToString(jpeg)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.apiURL("/playlists/"+url.PathEscape(playlistID)+"/images", nil), strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "image/jpeg")
+	return c.do(req, nil)
+}
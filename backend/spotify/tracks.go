@@ -0,0 +1,46 @@
+package spotify
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+// AudioFeatures is Spotify's audio analysis summary for one track. Key is a
+// pitch class (0 = C, 1 = C♯/D♭, ...) or -1 when no key was detected; Mode
+// is 1 for major and 0 for minor.
+type AudioFeatures struct {
+	ID               string  `json:"id"`
+	Tempo            float64 `json:"tempo"`
+	Energy           float64 `json:"energy"`
+	Valence          float64 `json:"valence"`
+	Danceability     float64 `json:"danceability"`
+	Acousticness     float64 `json:"acousticness"`
+	Instrumentalness float64 `json:"instrumentalness"`
+	Liveness         float64 `json:"liveness"`
+	Loudness         float64 `json:"loudness"`
+	Key              int     `json:"key"`
+	Mode             int     `json:"mode"`
+	TimeSignature    int     `json:"time_signature"`
+	DurationMs       int     `json:"duration_ms"`
+}
+
+// AudioFeatures fetches audio features for up to 100 tracks. Tracks Spotify
+// has no analysis for are left out of the result.
+func (c *Client) AudioFeatures(ctx context.Context, token string, ids []string) ([]AudioFeatures, error) {
+	q := url.Values{}
+	q.Set("ids", strings.Join(ids, ","))
+	var payload struct {
+		AudioFeatures []*AudioFeatures `json:"audio_features"`
+	}
+	if err := c.get(ctx, token, "/audio-features", q, &payload); err != nil {
+		return nil, err
+	}
+	features := make([]AudioFeatures, 0, len(payload.AudioFeatures))
+	for _, f := range payload.AudioFeatures {
+		if f != nil {
+			features = append(features, *f)
+		}
+	}
+	return features, nil
+}
@@ -0,0 +1,233 @@
+package spotify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrThrottled is matched (via errors.Is) by every error caused by Spotify
+// rate limiting or by the client-side request budget running out.
+var ErrThrottled = errors.New("spotify: upstream throttled")
+
+// ThrottledError reports that a request was given up on because of rate
+// limiting. RetryAfter is a hint for when the caller may try again.
+type ThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("spotify: upstream throttled, retry after %s", e.RetryAfter)
+}
+
+func (e *ThrottledError) Is(target error) bool { return target == ErrThrottled }
+
+// Budget is a process-wide token bucket shared by every request going through
+// a Transport. It also remembers Retry-After windows announced by Spotify so
+// that one 429 pauses all callers, not just the one that received it.
+type Budget struct {
+	mu           sync.Mutex
+	rate         float64 // tokens per second
+	burst        float64
+	tokens       float64
+	last         time.Time
+	blockedUntil time.Time
+	maxWait      time.Duration
+}
+
+// NewBudget allows perSecond requests on average with bursts of up to burst.
+// A request that would have to wait longer than maxWait fails with a
+// ThrottledError instead.
+func NewBudget(perSecond float64, burst int, maxWait time.Duration) *Budget {
+	return &Budget{
+		rate:    perSecond,
+		burst:   float64(burst),
+		tokens:  float64(burst),
+		last:    time.Now(),
+		maxWait: maxWait,
+	}
+}
+
+// reserve takes one token and returns how long the caller must wait before
+// using it.
+func (b *Budget) reserve() (time.Duration, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	var wait time.Duration
+	if b.tokens < 1 {
+		wait = time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	}
+	if blocked := b.blockedUntil.Sub(now); blocked > wait {
+		wait = blocked
+	}
+	if wait > b.maxWait {
+		return 0, &ThrottledError{RetryAfter: wait}
+	}
+	b.tokens--
+	return wait, nil
+}
+
+// block holds back every request until until.
+func (b *Budget) block(until time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if until.After(b.blockedUntil) {
+		b.blockedUntil = until
+	}
+}
+
+// Wait blocks until a request may be sent.
+func (b *Budget) Wait(ctx context.Context) error {
+	wait, err := b.reserve()
+	if err != nil {
+		return err
+	}
+	return sleep(ctx, wait)
+}
+
+// Transport is an http.RoundTripper for Spotify that respects Retry-After on
+// 429, retries idempotent requests on 429/5xx with jittered exponential
+// backoff, and meters all traffic through a shared Budget.
+type Transport struct {
+	Base       http.RoundTripper
+	Budget     *Budget
+	MaxRetries int           // default 3
+	BaseDelay  time.Duration // default 500ms
+	MaxDelay   time.Duration // longest single wait, default 10s
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+func (t *Transport) maxRetries() int {
+	if t.MaxRetries > 0 {
+		return t.MaxRetries
+	}
+	return 3
+}
+
+func (t *Transport) maxDelay() time.Duration {
+	if t.MaxDelay > 0 {
+		return t.MaxDelay
+	}
+	return 10 * time.Second
+}
+
+// backoff returns a full-jitter delay for the given attempt, never more
+// than MaxDelay.
+func (t *Transport) backoff(attempt int) time.Duration {
+	base := t.BaseDelay
+	if base <= 0 {
+		base = 500 * time.Millisecond
+	}
+	ceiling := base << attempt
+	if ceiling > t.maxDelay() || ceiling <= 0 {
+		ceiling = t.maxDelay()
+	}
+	return min(time.Duration(rand.Int64N(int64(ceiling)))+base/2, t.maxDelay())
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	idempotent := req.Method == http.MethodGet || req.Method == http.MethodHead
+
+	for attempt := 0; ; attempt++ {
+		if t.Budget != nil {
+			if err := t.Budget.Wait(ctx); err != nil {
+				return nil, err
+			}
+		}
+		resp, err := t.base().RoundTrip(req)
+		canRetry := idempotent && attempt < t.maxRetries()
+
+		if err != nil {
+			if !canRetry || ctx.Err() != nil {
+				return nil, err
+			}
+			if err := sleep(ctx, t.backoff(attempt)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests:
+			retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"))
+			if t.Budget != nil && retryAfter > 0 {
+				t.Budget.block(time.Now().Add(retryAfter))
+			}
+			drain(resp)
+			if !canRetry || retryAfter > t.maxDelay() {
+				return nil, &ThrottledError{RetryAfter: retryAfter}
+			}
+			wait := t.backoff(attempt)
+			if retryAfter > wait {
+				wait = retryAfter
+			}
+			if err := sleep(ctx, wait); err != nil {
+				return nil, err
+			}
+		case resp.StatusCode >= 500 && canRetry:
+			drain(resp)
+			if err := sleep(ctx, t.backoff(attempt)); err != nil {
+				return nil, err
+			}
+		default:
+			return resp, nil
+		}
+	}
+}
+
+// parseRetryAfter reads a Retry-After header in seconds. Spotify always
+// sends seconds, but an HTTP date is accepted too.
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+func drain(resp *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,212 @@
+package spotify
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// statusServer answers with the given statuses in turn, then 200, setting
+// Retry-After on 429s. It counts the requests it gets.
+func statusServer(t *testing.T, retryAfter string, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1))
+		if n <= len(statuses) {
+			if statuses[n-1] == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func get(ctx context.Context, t *Transport, url string) (*http.Response, error) {
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	return t.RoundTrip(req)
+}
+
+func TestTransportHonoursRetryAfter(t *testing.T) {
+	srv, calls := statusServer(t, "1", http.StatusTooManyRequests)
+	budget := NewBudget(1000, 10, 5*time.Second)
+	tr := &Transport{Budget: budget, BaseDelay: time.Millisecond}
+
+	start := time.Now()
+	resp, err := get(context.Background(), tr, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, want at least the 1s Retry-After", elapsed)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("got %d requests, want 2", n)
+	}
+	// The 429 held back everyone sharing the budget, not just the caller
+	budget.block(time.Now().Add(200 * time.Millisecond))
+	if wait, err := budget.reserve(); err != nil || wait < 150*time.Millisecond {
+		t.Errorf("reserve after a block = %v, %v; want to wait out the block", wait, err)
+	}
+}
+
+func TestTransportGivesUpOnLongRetryAfter(t *testing.T) {
+	srv, calls := statusServer(t, "60", http.StatusTooManyRequests)
+	tr := &Transport{BaseDelay: time.Millisecond, MaxDelay: time.Second}
+
+	_, err := get(context.Background(), tr, srv.URL)
+	var throttled *ThrottledError
+	if !errors.As(err, &throttled) || !errors.Is(err, ErrThrottled) || throttled.RetryAfter != time.Minute {
+		t.Fatalf("err = %v, want a ThrottledError retrying after 1m", err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("got %d requests, want 1", n)
+	}
+}
+
+func TestTransportRetriesServerErrors(t *testing.T) {
+	srv, calls := statusServer(t, "", http.StatusBadGateway, http.StatusServiceUnavailable)
+	tr := &Transport{BaseDelay: time.Millisecond}
+	resp, err := get(context.Background(), tr, srv.URL)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("got %v, %v; want 200 after retrying", resp, err)
+	}
+	resp.Body.Close()
+	if n := calls.Load(); n != 3 {
+		t.Errorf("got %d requests, want 3", n)
+	}
+
+	// Retries stop after MaxRetries, returning the last answer
+	srv, calls = statusServer(t, "", 500, 500, 500, 500, 500)
+	tr = &Transport{BaseDelay: time.Millisecond, MaxRetries: 2}
+	resp, err = get(context.Background(), tr, srv.URL)
+	if err != nil || resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("got %v, %v; want the 500", resp, err)
+	}
+	resp.Body.Close()
+	if n := calls.Load(); n != 3 {
+		t.Errorf("got %d requests, want 3", n)
+	}
+
+	// Writes aren't retried
+	srv, calls = statusServer(t, "", http.StatusBadGateway)
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader("{}"))
+	resp, err = tr.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("got %v, %v; want the 502", resp, err)
+	}
+	resp.Body.Close()
+	if n := calls.Load(); n != 1 {
+		t.Errorf("POST sent %d times, want once", n)
+	}
+}
+
+func TestTransportBackoff(t *testing.T) {
+	tr := &Transport{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt := 0; attempt < 64; attempt++ {
+		// Jitter runs from half the base delay to a ceiling that doubles
+		// each attempt, but never past MaxDelay
+		ceiling := time.Second
+		if attempt < 4 {
+			ceiling = 100*time.Millisecond<<attempt + 50*time.Millisecond
+		}
+		seen := make(map[time.Duration]bool)
+		for i := 0; i < 200; i++ {
+			d := tr.backoff(attempt)
+			if d < 50*time.Millisecond || d > ceiling {
+				t.Fatalf("backoff(%d) = %v, want between 50ms and %v", attempt, d, ceiling)
+			}
+			seen[d] = true
+		}
+		if len(seen) < 2 {
+			t.Errorf("backoff(%d) is always the same, want jitter", attempt)
+		}
+	}
+}
+
+func TestBudget(t *testing.T) {
+	b := NewBudget(10, 2, time.Second)
+	for i := 0; i < 2; i++ {
+		if wait, err := b.reserve(); err != nil || wait != 0 {
+			t.Fatalf("burst request %d: wait %v, %v; want none", i, wait, err)
+		}
+	}
+	start := time.Now()
+	if err := b.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("request past the burst waited %v, want about 100ms", elapsed)
+	}
+
+	// Waiting longer than maxWait fails fast
+	b = NewBudget(1, 1, 10*time.Millisecond)
+	b.reserve()
+	start = time.Now()
+	err := b.Wait(context.Background())
+	if !errors.Is(err, ErrThrottled) {
+		t.Errorf("err = %v, want %v", err, ErrThrottled)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("gave up after %v, want at once", elapsed)
+	}
+}
+
+func TestTransportCancellation(t *testing.T) {
+	// Cancelled while waiting for the budget
+	b := NewBudget(1, 1, time.Minute)
+	b.reserve()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := b.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("budget wait: err = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// Cancelled while waiting out a Retry-After
+	srv, calls := statusServer(t, "5", http.StatusTooManyRequests)
+	tr := &Transport{BaseDelay: time.Millisecond}
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := get(ctx, tr, srv.URL); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("retry wait: err = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("returned after %v, want soon after the deadline", elapsed)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("got %d requests, want 1", n)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"", 0},
+		{"0", 0},
+		{"3", 3 * time.Second},
+		{"-1", 0},
+		{"soon", 0},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.in); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+	future := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(future); got < 58*time.Second || got > time.Minute {
+		t.Errorf("parseRetryAfter(%q) = %v, want about 1m", future, got)
+	}
+}
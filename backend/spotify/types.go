@@ -0,0 +1,103 @@
+package spotify
+
+type ExternalURLs struct {
+	Spotify string `json:"spotify,omitempty"`
+}
+
+type Image struct {
+	URL    string `json:"url"`
+	Height int    `json:"height,omitempty"`
+	Width  int    `json:"width,omitempty"`
+}
+
+type Followers struct {
+	Total int `json:"total"`
+}
+
+// Artist covers both the full and the simplified artist objects; fields
+// missing from the simplified form are left zero.
+type Artist struct {
+	ID           string       `json:"id"`
+	Name         string       `json:"name"`
+	URI          string       `json:"uri,omitempty"`
+	Genres       []string     `json:"genres,omitempty"`
+	Popularity   int          `json:"popularity,omitempty"`
+	Followers    *Followers   `json:"followers,omitempty"`
+	Images       []Image      `json:"images,omitempty"`
+	ExternalURLs ExternalURLs `json:"external_urls"`
+}
+
+// Album covers the full and simplified album objects. Tracks is only set by
+// endpoints that return full albums.
+type Album struct {
+	ID                   string         `json:"id"`
+	Name                 string         `json:"name"`
+	URI                  string         `json:"uri,omitempty"`
+	AlbumType            string         `json:"album_type,omitempty"`
+	AlbumGroup           string         `json:"album_group,omitempty"`
+	ReleaseDate          string         `json:"release_date,omitempty"`
+	ReleaseDatePrecision string         `json:"release_date_precision,omitempty"`
+	TotalTracks          int            `json:"total_tracks,omitempty"`
+	Artists              []Artist       `json:"artists,omitempty"`
+	Images               []Image        `json:"images,omitempty"`
+	ExternalURLs         ExternalURLs   `json:"external_urls"`
+	Tracks               *Paging[Track] `json:"tracks,omitempty"`
+}
+
+type ExternalIDs struct {
+	ISRC string `json:"isrc,omitempty"`
+}
+
+// Track covers the full and simplified track objects. Simplified tracks (as
+// nested in an album) have no Album, Popularity or ExternalIDs.
+type Track struct {
+	ID           string       `json:"id"`
+	Name         string       `json:"name"`
+	URI          string       `json:"uri,omitempty"`
+	Artists      []Artist     `json:"artists"`
+	Album        Album        `json:"album"`
+	DurationMs   int          `json:"duration_ms"`
+	Explicit     bool         `json:"explicit"`
+	Popularity   int          `json:"popularity"`
+	TrackNumber  int          `json:"track_number,omitempty"`
+	DiscNumber   int          `json:"disc_number,omitempty"`
+	ExternalIDs  ExternalIDs  `json:"external_ids"`
+	ExternalURLs ExternalURLs `json:"external_urls"`
+}
+
+type User struct {
+	ID           string       `json:"id"`
+	DisplayName  string       `json:"display_name,omitempty"`
+	Email        string       `json:"email,omitempty"`
+	ExternalURLs ExternalURLs `json:"external_urls"`
+}
+
+type PlaylistTracksRef struct {
+	Href  string `json:"href"`
+	Total int    `json:"total"`
+}
+
+type Playlist struct {
+	ID            string            `json:"id"`
+	Name          string            `json:"name"`
+	Description   string            `json:"description,omitempty"`
+	Public        *bool             `json:"public,omitempty"`
+	Collaborative bool              `json:"collaborative"`
+	Owner         User              `json:"owner"`
+	SnapshotID    string            `json:"snapshot_id,omitempty"`
+	URI           string            `json:"uri,omitempty"`
+	Images        []Image           `json:"images,omitempty"`
+	ExternalURLs  ExternalURLs      `json:"external_urls"`
+	Tracks        PlaylistTracksRef `json:"tracks"`
+}
+
+// Paging is Spotify's generic page of results.
+type Paging[T any] struct {
+	Href     string `json:"href"`
+	Items    []T    `json:"items"`
+	Limit    int    `json:"limit"`
+	Offset   int    `json:"offset"`
+	Total    int    `json:"total"`
+	Next     string `json:"next"`
+	Previous string `json:"previous"`
+}
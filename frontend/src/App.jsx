@@ -7,6 +7,7 @@ import Navbar from "./components/Navbar.jsx";
 import LandingPage from "./components/LandingPage.jsx";
 import MainPage from "./components/MainPage.jsx";
 import HistoryPage from "./components/HistoryPage.jsx";
+import InvitePage from "./components/InvitePage.jsx";
 import NotFound from "./pages/NotFound.jsx";
 
 const queryClient = new QueryClient();
@@ -23,6 +24,7 @@ const App = () => (
             <Route path="/" element={<LandingPage />} />
             <Route path="/playlist" element={<MainPage />} />
             <Route path="/history" element={<HistoryPage />} />
+            <Route path="/blend/invite/:code" element={<InvitePage />} />
             <Route path="*" element={<NotFound />} />
           </Routes>
         </div>
@@ -0,0 +1,102 @@
+import { useState, useEffect } from "react";
+import { useParams } from "react-router-dom";
+import { Card } from "@/components/ui/card";
+import { Button } from "@/components/ui/button";
+import TrackList from "./TrackList.jsx";
+import { Users, Calendar } from "lucide-react";
+import { fetchBlendInvite, acceptBlendInvite, authenticateSpotify } from "@/lib/api";
+
+const InvitePage = () => {
+  const { code } = useParams();
+  const [invite, setInvite] = useState(null);
+  const [blend, setBlend] = useState(null);
+  const [loading, setLoading] = useState(true);
+  const [accepting, setAccepting] = useState(false);
+  const [error, setError] = useState("");
+
+  useEffect(() => {
+    (async () => {
+      try {
+        setInvite(await fetchBlendInvite(code));
+      } catch (e) {
+        if (e?.response?.status === 401) {
+          // Log in first; Spotify sends us back to this invite
+          authenticateSpotify();
+          return;
+        }
+        setError(e?.response?.data || "This invite could not be loaded.");
+      } finally {
+        setLoading(false);
+      }
+    })();
+  }, [code]);
+
+  const accept = async () => {
+    setAccepting(true);
+    setError("");
+    try {
+      setBlend(await acceptBlendInvite(code));
+    } catch (e) {
+      setError(e?.response?.data || "Failed to accept the invite.");
+    } finally {
+      setAccepting(false);
+    }
+  };
+
+  const formatDate = (dateString) =>
+    new Date(dateString).toLocaleDateString('en-US', { month: 'short', day: 'numeric' });
+
+  if (blend) {
+    return (
+      <div className="container mx-auto px-4 py-8">
+        <div className="max-w-4xl mx-auto">
+          <TrackList
+            tracks={blend.tracks || []}
+            playlistTitle="Friend Blend"
+            seed={blend.seed}
+          />
+        </div>
+      </div>
+    );
+  }
+
+  return (
+    <div className="container mx-auto px-4 py-8">
+      <div className="max-w-xl mx-auto">
+        <Card className="p-12 text-center card-shadow bg-card/50 backdrop-blur-sm">
+          <div className="gradient-glow w-20 h-20 rounded-full flex items-center justify-center mx-auto mb-6">
+            <Users className="w-10 h-10 text-white" />
+          </div>
+          {loading ? (
+            <p className="text-muted-foreground">Loading invite...</p>
+          ) : invite ? (
+            <>
+              <h3 className="text-xl font-semibold mb-2">You're Invited to a Blend</h3>
+              <p className="text-muted-foreground mb-4">
+                Mix your taste with a friend's into a {invite.length}-track playlist.
+              </p>
+              <div className="flex items-center justify-center space-x-2 text-xs text-muted-foreground mb-6">
+                <Calendar className="w-3 h-3" />
+                <span>Expires {formatDate(invite.expiresAt)}</span>
+              </div>
+              {error && <p className="text-sm text-destructive mb-4">{error}</p>}
+              <Button onClick={accept} disabled={accepting} className="glow-effect">
+                {accepting ? "Blending..." : "Accept Invite"}
+              </Button>
+            </>
+          ) : (
+            <>
+              <h3 className="text-xl font-semibold mb-2">Invite Unavailable</h3>
+              <p className="text-muted-foreground mb-6">{error}</p>
+              <Button asChild variant="outline">
+                <a href="/">Return to Home</a>
+              </Button>
+            </>
+          )}
+        </Card>
+      </div>
+    </div>
+  );
+};
+
+export default InvitePage;
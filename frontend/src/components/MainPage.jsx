@@ -10,6 +10,7 @@ const MainPage = () => {
   const [tracks, setTracks] = useState([]);
   const [isLoading, setIsLoading] = useState(false);
   const [currentArtists, setCurrentArtists] = useState([]);
+  const [blendInfo, setBlendInfo] = useState({});
   const { toast } = useToast();
   const resultsRef = useRef(null);
 
@@ -20,6 +21,7 @@ const MainPage = () => {
     try {
       const playlist = await generatePlaylist(artists);
       setTracks(playlist.tracks || []);
+      setBlendInfo({ seed: playlist.seed, request: playlist.request });
       
       toast({
         title: "Playlist Generated!",
@@ -67,6 +69,7 @@ const MainPage = () => {
       ];
       
       setTracks(mockTracks);
+      setBlendInfo({});
       
       toast({
         title: "Demo Playlist Generated!",
@@ -127,6 +130,8 @@ const MainPage = () => {
             <TrackList 
               tracks={tracks} 
               artists={currentArtists}
+              seed={blendInfo.seed}
+              request={blendInfo.request}
               playlistTitle={`${currentArtists.join(" × ")} Blend`}
             />
           </div>
@@ -6,7 +6,7 @@ import { useState } from "react";
 import { useAuth } from "@/hooks/useAuth";
 import LoginModal from "./LoginModal";
 
-const TrackList = ({ tracks, playlistTitle, artists = [] }) => {
+const TrackList = ({ tracks, playlistTitle, artists = [], seed, request }) => {
   const [creating, setCreating] = useState(false);
   const [createError, setCreateError] = useState("");
   const [saved, setSaved] = useState(false);
@@ -115,6 +115,9 @@ const TrackList = ({ tracks, playlistTitle, artists = [] }) => {
               const { url } = await createSpotifyPlaylist({
                 name: playlistTitle || "ArtistBlend Playlist",
                 trackIds,
+                description: "Blended from {artists} with ArtistBlend",
+                artists,
+                request,
               })
               if (url) {
                 window.open(url, "_blank", "noopener,noreferrer")
@@ -141,6 +144,8 @@ const TrackList = ({ tracks, playlistTitle, artists = [] }) => {
                   title: playlistTitle || "ArtistBlend Playlist",
                   artists,
                   tracks,
+                  seed,
+                  request,
                 })
                 setSaved(true)
               } catch (e) {
@@ -190,6 +195,9 @@ const TrackList = ({ tracks, playlistTitle, artists = [] }) => {
               const { url } = await createSpotifyPlaylist({
                 name: playlistTitle || "ArtistBlend Playlist",
                 trackIds,
+                description: "Blended from {artists} with ArtistBlend",
+                artists,
+                request,
               });
               if (url) {
                 window.open(url, "_blank", "noopener,noreferrer");
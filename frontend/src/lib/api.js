@@ -75,7 +75,7 @@ export const authenticateSpotify = async () => {
     localStorage.setItem('loginRedirectPath', currentPath);
     
     // Redirect to the Go backend's login endpoint
-    window.location.href = `${API_BASE_URL}/login`;
+    window.location.href = `${API_BASE_URL}/login?return_to=${encodeURIComponent(currentPath)}`;
   } catch (error) {
     console.error('Error initiating Spotify auth:', error);
     throw error;
@@ -106,11 +106,22 @@ export const searchArtists = async (query) => {
   }
 };
 
-export const createSpotifyPlaylist = async ({ name, trackIds }) => {
+// mode is "create" (default), "replace" or "append"; the last two update the
+// saved playlist playlistId. description may use {artists} and {date}.
+export const createSpotifyPlaylist = async ({ name, trackIds, description, isPublic, collaborative, artists, mode, playlistId, onFailure, resume, request }) => {
   try {
     const response = await api.post('/api/playlist/create', {
       name,
-      trackIds
+      trackIds,
+      description,
+      public: isPublic,
+      collaborative,
+      artists,
+      mode,
+      playlistId,
+      onFailure,
+      resume,
+      request
     });
     return response.data;
   } catch (error) {
@@ -125,11 +136,43 @@ export const fetchHistory = async () => {
   return data;
 };
 
-export const saveHistory = async ({ title, artists, tracks }) => {
-  const { data } = await api.post('/api/history', { title, artists, tracks });
+export const saveHistory = async ({ title, artists, tracks, seed, request }) => {
+  const { data } = await api.post('/api/history', { title, artists, tracks, seed, request });
   return data;
 };
 
 export const deleteHistory = async (id) => {
   await api.delete(`/api/history/${id}`);
 };
+
+// Friend blends
+export const createBlendInvite = async ({ length } = {}) => {
+  const { data } = await api.post('/api/friends/invites', length ? { length } : {});
+  return data;
+};
+
+export const fetchBlendInvite = async (code) => {
+  const { data } = await api.get(`/api/friends/invites/${encodeURIComponent(code)}`);
+  return data;
+};
+
+export const acceptBlendInvite = async (code) => {
+  const { data } = await api.post(`/api/friends/invites/${encodeURIComponent(code)}/accept`);
+  return data;
+};
+
+export const fetchFriendBlends = async () => {
+  const { data } = await api.get('/api/friends/blends');
+  return data;
+};
+
+// Auto-refresh: interval is "daily", "weekly" or "off"
+export const setPlaylistRefresh = async (playlistId, interval) => {
+  const { data } = await api.put(`/api/playlist/${encodeURIComponent(playlistId)}/refresh`, { interval });
+  return data;
+};
+
+export const fetchPlaylistRefresh = async (playlistId) => {
+  const { data } = await api.get(`/api/playlist/${encodeURIComponent(playlistId)}/refresh`);
+  return data;
+};